@@ -0,0 +1,338 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+)
+
+type State string
+
+const (
+	Inactive State = "inactive"
+	Pending  State = "pending"
+	Firing   State = "firing"
+	Resolved State = "resolved"
+)
+
+const defaultLogWindow = 15 * time.Minute
+
+// A time.Duration that reads and writes as a string such as "5m" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// A rule compares a snapshot field, a computed rate or the number of log entries matching
+// LogPattern and/or classified as LogCategory within LogWindow against Value (or Text for
+// string fields). The condition has to hold for For before the alert fires.
+type Rule struct {
+	Name        string            `json:"name"`
+	Field       string            `json:"field,omitempty"`
+	LogPattern  string            `json:"log_pattern,omitempty"`
+	LogCategory string            `json:"log_category,omitempty"`
+	LogWindow   Duration          `json:"log_window,omitempty"`
+	Op          string            `json:"op"`
+	Value       float64           `json:"value"`
+	Text        string            `json:"text,omitempty"`
+	For         Duration          `json:"for"`
+	Severity    string            `json:"severity"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+var DefaultRules = []Rule{
+	{
+		Name:        "NoLockedDownstream",
+		Field:       "locked_downstream",
+		Op:          "==",
+		Value:       0,
+		For:         Duration(time.Minute),
+		Severity:    "critical",
+		Description: "no downstream channel is locked",
+	},
+	{
+		Name:        "LowHealthScore",
+		Field:       "health_score",
+		Op:          "<",
+		Value:       50,
+		For:         Duration(5 * time.Minute),
+		Severity:    "warning",
+		Description: "line health score below 50",
+	},
+	{
+		Name:        "RangingTimeouts",
+		LogPattern:  `T[34] time-?out`,
+		Op:          ">=",
+		Value:       3,
+		For:         Duration(0),
+		Severity:    "warning",
+		Description: "repeated T3/T4 ranging time-outs",
+	},
+}
+
+// Read rules from a JSON file holding a list of rules.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// The values rules are evaluated against for a single poll.
+type Sample struct {
+	Time       time.Time
+	Values     map[string]float64
+	Strings    map[string]string
+	LogEntries []modem.LogEntry
+}
+
+type Alert struct {
+	Rule        string            `json:"rule"`
+	State       State             `json:"state"`
+	Severity    string            `json:"severity"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Value       string            `json:"value"`
+	ActiveSince time.Time         `json:"active_since"`
+	FiredAt     time.Time         `json:"fired_at,omitempty"`
+	ResolvedAt  time.Time         `json:"resolved_at,omitempty"`
+}
+
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// How many batches of transitions can wait for the notifiers before Evaluate blocks.
+const notificationQueueSize = 100
+
+type Engine struct {
+	rules     []Rule
+	statePath string
+	notifiers []Notifier
+	mutex     sync.Mutex
+	state     map[string]*Alert
+	// Transitions waiting for the notifiers, in the order they happened.
+	queue   chan []Alert
+	pending sync.WaitGroup
+}
+
+// Create an engine for rules, restoring alert state from statePath when it exists so that an
+// alert that was already firing before a restart is not announced a second time.
+func NewEngine(rules []Rule, statePath string, notifiers ...Notifier) (*Engine, error) {
+	e := &Engine{statePath: statePath, notifiers: notifiers, state: map[string]*Alert{}}
+	for _, rule := range rules {
+		if rule.Field == "" && rule.LogPattern == "" && rule.LogCategory == "" {
+			return nil, fmt.Errorf("rule %s: needs a field, log_pattern or log_category", rule.Name)
+		}
+		if rule.LogPattern != "" || rule.LogCategory != "" {
+			pattern, err := regexp.Compile(rule.LogPattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			rule.pattern = pattern
+			if rule.LogWindow == 0 {
+				rule.LogWindow = Duration(defaultLogWindow)
+			}
+		}
+		if _, ok := operators[rule.Op]; !ok {
+			return nil, fmt.Errorf("rule %s: unknown operator %q", rule.Name, rule.Op)
+		}
+		e.rules = append(e.rules, rule)
+	}
+	if statePath != "" {
+		data, err := os.ReadFile(statePath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &e.state); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", statePath, err)
+			}
+		}
+	}
+	e.queue = make(chan []Alert, notificationQueueSize)
+	go e.deliver()
+	return e, nil
+}
+
+func (e *Engine) AddNotifier(n Notifier) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.notifiers = append(e.notifiers, n)
+}
+
+// Evaluate every rule against the sample and return the alerts that changed to firing or
+// resolved. Notifiers are only called for those transitions, in the background, so that a slow
+// mail server does not hold up the caller; Wait waits for them.
+func (e *Engine) Evaluate(sample Sample) []Alert {
+	transitions := e.evaluate(sample)
+	if len(transitions) > 0 {
+		e.pending.Add(1)
+		e.queue <- transitions
+	}
+	return transitions
+}
+
+func (e *Engine) evaluate(sample Sample) []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var transitions []Alert
+	changed := false
+	for _, rule := range e.rules {
+		met, value := rule.evaluate(sample)
+		alert, ok := e.state[rule.Name]
+		if !ok {
+			alert = &Alert{Rule: rule.Name, State: Inactive}
+			e.state[rule.Name] = alert
+		}
+		alert.Severity, alert.Labels, alert.Description, alert.Value = rule.Severity, rule.Labels, rule.Description, value
+
+		previous := alert.State
+		switch {
+		case met && (alert.State == Inactive || alert.State == Resolved):
+			alert.State = Pending
+			alert.ActiveSince = sample.Time
+			alert.FiredAt, alert.ResolvedAt = time.Time{}, time.Time{}
+			fallthrough
+		case met && alert.State == Pending:
+			if sample.Time.Sub(alert.ActiveSince) >= time.Duration(rule.For) {
+				alert.State = Firing
+				alert.FiredAt = sample.Time
+			}
+		case !met && alert.State == Pending:
+			alert.State = Inactive
+		case !met && alert.State == Firing:
+			alert.State = Resolved
+			alert.ResolvedAt = sample.Time
+		}
+		if alert.State == previous {
+			continue
+		}
+		changed = true
+		if alert.State == Firing || alert.State == Resolved {
+			transitions = append(transitions, *alert)
+		}
+	}
+	if changed {
+		e.save()
+	}
+	return transitions
+}
+
+func (e *Engine) deliver() {
+	for transitions := range e.queue {
+		e.mutex.Lock()
+		notifiers := append([]Notifier(nil), e.notifiers...)
+		e.mutex.Unlock()
+		for _, alert := range transitions {
+			for _, n := range notifiers {
+				if err := n.Notify(alert); err != nil {
+					log.Printf("Alert notification for %s failed: %v\n", alert.Rule, err)
+				}
+			}
+		}
+		e.pending.Done()
+	}
+}
+
+// Wait until the notifiers have been told about every transition so far.
+func (e *Engine) Wait() {
+	e.pending.Wait()
+}
+
+// Active returns the pending and firing alerts ordered by rule name.
+func (e *Engine) Active() []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var active []Alert
+	for _, alert := range e.state {
+		if alert.State == Pending || alert.State == Firing {
+			active = append(active, *alert)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Rule < active[j].Rule })
+	return active
+}
+
+func (e *Engine) save() {
+	if e.statePath == "" {
+		return
+	}
+	data, _ := json.MarshalIndent(e.state, "", "  ")
+	tmpPath := e.statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmpPath, e.statePath)
+}
+
+var operators = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+func (r *Rule) evaluate(sample Sample) (bool, string) {
+	if r.pattern != nil {
+		count := 0
+		for _, entry := range sample.LogEntries {
+			if entry.Time.IsZero() || sample.Time.Sub(entry.Time) > time.Duration(r.LogWindow) {
+				continue
+			}
+			if r.LogCategory != "" && entry.Event.Category != r.LogCategory {
+				continue
+			}
+			if r.pattern.MatchString(entry.Message) {
+				count++
+			}
+		}
+		return operators[r.Op](float64(count), r.Value), fmt.Sprintf("%d", count)
+	}
+	if text, ok := sample.Strings[r.Field]; ok {
+		switch r.Op {
+		case "==":
+			return text == r.Text, text
+		case "!=":
+			return text != r.Text, text
+		}
+		return false, text
+	}
+	value, ok := sample.Values[r.Field]
+	if !ok {
+		return false, ""
+	}
+	return operators[r.Op](value, r.Value), fmt.Sprintf("%g", value)
+}
@@ -0,0 +1,330 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileSuffix = ".jsonl.gz"
+
+// Files are partitioned by UTC hour: <dir>/<modem>/2006/01/02/15.jsonl.gz
+const partitionLayout = "2006/01/02/15"
+
+// A raw modem response as it came off the wire.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Modem  string    `json:"modem"`
+	Action string    `json:"action"`
+	Body   string    `json:"body"`
+}
+
+type Config struct {
+	Dir   string
+	Modem string
+	// Partitions older than Retention are deleted, then the oldest partitions until the
+	// archive is no larger than MaxBytes. Zero disables either limit.
+	Retention time.Duration
+	MaxBytes  int64
+}
+
+// Writes raw responses into compressed hourly files. Every record is written as its own gzip
+// member, and a member cut short by a crash is cut off the file before anything is appended to
+// it again, so a crash loses at most the record being written and the files can still be read
+// with any gzip tool.
+type Archive struct {
+	config    Config
+	mutex     sync.Mutex
+	partition string
+}
+
+func New(config Config) (*Archive, error) {
+	if err := os.MkdirAll(filepath.Join(config.Dir, config.Modem), 0755); err != nil {
+		return nil, err
+	}
+	a := &Archive{config: config}
+	if err := a.Prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Record implements mb8611.Recorder. Failures are logged rather than returned so that a full
+// disk never stops collection.
+func (a *Archive) Record(action string, body []byte, at time.Time) {
+	if err := a.Write(Record{Time: at.UTC(), Modem: a.config.Modem, Action: action, Body: string(body)}); err != nil {
+		log.Printf("Archiving %s response failed: %v\n", action, err)
+	}
+}
+
+func (a *Archive) Write(record Record) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	partition := record.Time.UTC().Format(partitionLayout)
+	path := filepath.Join(a.config.Dir, a.config.Modem, filepath.FromSlash(partition)+fileSuffix)
+	if partition != a.partition {
+		// Starting a new partition is a good time to enforce the limits. Pruning removes empty
+		// directories, so it has to happen before the directory of the new partition is made.
+		if a.partition != "" {
+			if err := a.prune(record.Time); err != nil {
+				log.Printf("Pruning archive failed: %v\n", err)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		// The file may end in a member an earlier process was writing when it died. Records
+		// appended after it could never be read.
+		if err := repair(path); err != nil {
+			return err
+		}
+		a.partition = partition
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	if _, err = zw.Write(append(data, '\n')); err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		// Take back whatever part of the member made it to disk, e.g. when the disk filled up.
+		f.Truncate(info.Size())
+	}
+	return err
+}
+
+// Cut the file back to its last complete member if it ends in one that was cut short.
+func repair(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	// Only appends are made to the file, so whatever cannot be read after the last complete
+	// member is what was left of the append that did not finish.
+	end, err := members(f, func([]byte) error { return nil })
+	if err != nil {
+		log.Printf("Cutting the incomplete record off the end of %s: %v\n", path, err)
+		return f.Truncate(end)
+	}
+	return nil
+}
+
+// Prune enforces the retention and size limits.
+func (a *Archive) Prune(now time.Time) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.prune(now)
+}
+
+func (a *Archive) prune(now time.Time) error {
+	files, err := partitions(a.config.Dir, a.config.Modem)
+	if err != nil {
+		return err
+	}
+	current := filepath.Join(a.config.Dir, a.config.Modem, filepath.FromSlash(now.UTC().Format(partitionLayout))+fileSuffix)
+	var total int64
+	var kept []partitionFile
+	for _, f := range files {
+		if a.config.Retention > 0 && f.hour.Add(time.Hour).Before(now.Add(-a.config.Retention)) && f.path != current {
+			if err := os.Remove(f.path); err != nil {
+				return err
+			}
+			continue
+		}
+		total += f.size
+		kept = append(kept, f)
+	}
+	for _, f := range kept {
+		if a.config.MaxBytes <= 0 || total <= a.config.MaxBytes || f.path == current {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+		total -= f.size
+	}
+	removeEmptyDirs(filepath.Join(a.config.Dir, a.config.Modem))
+	return nil
+}
+
+type partitionFile struct {
+	path string
+	hour time.Time
+	size int64
+}
+
+// The archive files of a modem, oldest first.
+func partitions(dir, modem string) ([]partitionFile, error) {
+	root := filepath.Join(dir, modem)
+	var files []partitionFile
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, fileSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, strings.TrimSuffix(path, fileSuffix))
+		if err != nil {
+			return err
+		}
+		hour, err := time.Parse(partitionLayout, filepath.ToSlash(rel))
+		if err != nil {
+			// Not one of ours.
+			return nil
+		}
+		files = append(files, partitionFile{path: path, hour: hour, size: info.Size()})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].hour.Before(files[j].hour) })
+	return files, err
+}
+
+func removeEmptyDirs(root string) {
+	var dirs []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	// Deepest first, so that emptied parents are removed as well.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
+
+// Read calls fn for every record of the modem archived in [since, until), in order. A zero
+// until means no upper bound. A record cut short at the end of a file, such as the one being
+// written, is skipped; a file damaged anywhere else is an error.
+func Read(dir, modem string, since, until time.Time, fn func(Record) error) error {
+	files, err := partitions(dir, modem)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !f.hour.Add(time.Hour).After(since) || (!until.IsZero() && !f.hour.Before(until)) {
+			continue
+		}
+		if err := readFile(f.path, since, until, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(path string, since, until time.Time, fn func(Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = members(file, func(data []byte) error {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var record Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				continue
+			}
+			if record.Time.Before(since) || (!until.IsZero() && !record.Time.Before(until)) {
+				continue
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil && !errors.Is(err, errTruncated) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Returned by members when the last member ends with the file.
+var errTruncated = errors.New("last gzip member cut short")
+
+// Calls fn with the contents of every gzip member of r, in order, and returns the offset at which
+// the last complete member ends.
+func members(r io.Reader, fn func([]byte) error) (int64, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+	var zr gzip.Reader
+	var end int64
+	for {
+		err := zr.Reset(cr)
+		if err == io.EOF && cr.n == end {
+			return end, nil
+		}
+		var data []byte
+		if err == nil {
+			zr.Multistream(false)
+			data, err = io.ReadAll(&zr)
+		}
+		if err != nil {
+			if cr.eof {
+				return end, errTruncated
+			}
+			return end, err
+		}
+		end = cr.n
+		if err := fn(data); err != nil {
+			return end, err
+		}
+	}
+}
+
+// Counts the bytes taken from r. Being an io.ByteReader keeps the gzip reader from reading
+// ahead, so the count tells where each member ends.
+type countingReader struct {
+	r   *bufio.Reader
+	n   int64
+	eof bool
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.eof = c.eof || err == io.EOF
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	c.eof = c.eof || err == io.EOF
+	return b, err
+}
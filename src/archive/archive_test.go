@@ -0,0 +1,109 @@
+package archive_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/archive"
+)
+
+var hour = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func record(minute int) archive.Record {
+	return archive.Record{Time: hour.Add(time.Duration(minute) * time.Minute), Modem: "mb8611", Action: "logs", Body: "body"}
+}
+
+func write(t *testing.T, dir string, minutes ...int) {
+	t.Helper()
+	a, err := archive.New(archive.Config{Dir: dir, Modem: "mb8611"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, minute := range minutes {
+		if err := a.Write(record(minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func read(t *testing.T, dir string) ([]int, error) {
+	t.Helper()
+	var minutes []int
+	err := archive.Read(dir, "mb8611", hour, time.Time{}, func(r archive.Record) error {
+		minutes = append(minutes, int(r.Time.Sub(hour)/time.Minute))
+		return nil
+	})
+	return minutes, err
+}
+
+func file(dir string) string {
+	return filepath.Join(dir, "mb8611", "2026", "03", "01", "12.jsonl.gz")
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Cut the last n bytes off the partition file, as a crash in the middle of a write would.
+func cut(t *testing.T, dir string, n int64) {
+	t.Helper()
+	info, err := os.Stat(file(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(file(dir), info.Size()-n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCrashDuringWrite(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, 0, 1, 2)
+	cut(t, dir, 5)
+
+	// Whoever reads the file while it is in this state misses only the record cut short.
+	minutes, err := read(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1}; !equal(minutes, want) {
+		t.Errorf("read %v before the restart, want %v", minutes, want)
+	}
+
+	// The restarted writer appends to the same hour.
+	write(t, dir, 3, 4)
+	minutes, err = read(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 3, 4}; !equal(minutes, want) {
+		t.Errorf("read %v after the restart, want %v", minutes, want)
+	}
+}
+
+func TestDamageInsideFile(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, 0, 1)
+	data, err := os.ReadFile(file(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a byte inside the first member's compressed data.
+	data[len(data)/4] ^= 0xff
+	if err := os.WriteFile(file(dir), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := read(t, dir); err == nil {
+		t.Error("a file damaged before its last record read without error")
+	}
+}
@@ -0,0 +1,153 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	// Requests go through as usual.
+	Closed State = "closed"
+	// The modem is unreachable; requests are held back until the next probe is due.
+	Open State = "open"
+	// A single probe request is on its way to find out whether the modem is back.
+	HalfOpen State = "half_open"
+)
+
+type Config struct {
+	// Consecutive failures after which the modem is taken to be unreachable.
+	Threshold int
+	// How long to wait after the first failure. The wait doubles with every further failure,
+	// up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Called, without the breaker locked, when the circuit opens or closes.
+	OnChange func(from, to State, status Status)
+}
+
+// The state of the breaker, as reported to sinks and the API.
+type Status struct {
+	State State
+	// Failed requests since the last successful one.
+	Failures  int
+	LastError string
+	// When the circuit last opened; zero while it has not.
+	Since time.Time
+	// When requests are let through again; zero when they are not held back.
+	RetryAt time.Time
+}
+
+// Backs off from a modem that stops answering and stops talking to it altogether once it has
+// failed Threshold times in a row. While the circuit is open, a single probe is let through
+// each time the backoff delay has passed; the first request that succeeds closes it again.
+type Breaker struct {
+	config Config
+	mutex  sync.Mutex
+	status Status
+	// When the latest request was allowed. The backoff counts from there rather than from when
+	// the request failed, so that retries line up with the schedule that makes them.
+	attempt time.Time
+}
+
+func New(config Config) *Breaker {
+	if config.Threshold <= 0 {
+		config.Threshold = 3
+	}
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = 10 * time.Second
+	}
+	if config.MaxDelay < config.BaseDelay {
+		config.MaxDelay = config.BaseDelay
+	}
+	return &Breaker{config: config, status: Status{State: Closed}}
+}
+
+// Whether a request may be made at now. Once the delay has passed on an open circuit, the
+// request allowed is the probe, and no other is until its outcome has been reported.
+func (b *Breaker) Allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch {
+	case b.status.State == HalfOpen:
+		return false
+	case now.Before(b.status.RetryAt):
+		// Backing off, whether or not the circuit has opened yet.
+		return false
+	case b.status.State == Open:
+		b.status.State = HalfOpen
+	}
+	b.attempt = now
+	return true
+}
+
+// Report a request that the modem answered. When that closes the circuit, OnChange is given
+// the status from before, so that it can tell how long the modem was unreachable.
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	previous := b.status
+	b.status = Status{State: Closed}
+	b.mutex.Unlock()
+	if previous.State != Closed {
+		b.changed(Open, Closed, previous)
+	}
+}
+
+// Report a request that the modem did not answer.
+func (b *Breaker) Failure(err error) {
+	b.mutex.Lock()
+	now := b.attempt
+	if now.IsZero() {
+		now = time.Now()
+	}
+	b.status.Failures++
+	b.status.LastError = err.Error()
+	// A little early, so that a retry on the same schedule does not miss its tick by the time the
+	// tick took to fire.
+	delay := b.delay(b.status.Failures)
+	b.status.RetryAt = now.Add(delay - delay/10)
+	opened := false
+	switch b.status.State {
+	case HalfOpen:
+		b.status.State = Open
+	case Closed:
+		if b.status.Failures >= b.config.Threshold {
+			b.status.State, b.status.Since = Open, now
+			opened = true
+		}
+	}
+	status := b.status
+	b.mutex.Unlock()
+	if opened {
+		b.changed(Closed, Open, status)
+	}
+}
+
+// The delay after the given number of consecutive failures.
+func (b *Breaker) delay(failures int) time.Duration {
+	delay := b.config.BaseDelay
+	for i := 1; i < failures && delay < b.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.config.MaxDelay {
+		delay = b.config.MaxDelay
+	}
+	return delay
+}
+
+func (b *Breaker) changed(from, to State, status Status) {
+	if b.config.OnChange != nil {
+		b.config.OnChange(from, to, status)
+	}
+}
+
+// The current state. A nil breaker is always closed.
+func (b *Breaker) Status() Status {
+	if b == nil {
+		return Status{State: Closed}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.status
+}
@@ -0,0 +1,204 @@
+package breaker_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/breaker"
+)
+
+const (
+	allow   = "allow"
+	fail    = "fail"
+	succeed = "succeed"
+)
+
+// One call on the breaker, made at the given offset from the start of the test.
+type step struct {
+	at     time.Duration
+	action string
+	// For allow: whether the request is let through.
+	allowed bool
+	// The state after the call.
+	state breaker.State
+	// For fail: how long after the allowed request the next one is let through. Zero skips the
+	// check.
+	retryIn time.Duration
+}
+
+var start = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestBreaker(t *testing.T) {
+	config := breaker.Config{Threshold: 3, BaseDelay: 10 * time.Second, MaxDelay: 40 * time.Second}
+	for _, test := range []struct {
+		name    string
+		config  breaker.Config
+		steps   []step
+		changes []string
+	}{
+		{
+			name:   "opens after the threshold",
+			config: config,
+			steps: []step{
+				{at: 0, action: allow, allowed: true, state: breaker.Closed},
+				{at: 0, action: fail, state: breaker.Closed, retryIn: 9 * time.Second},
+				// Backing off before the circuit opens.
+				{at: 5 * time.Second, action: allow, allowed: false, state: breaker.Closed},
+				{at: 9 * time.Second, action: allow, allowed: true, state: breaker.Closed},
+				{at: 9 * time.Second, action: fail, state: breaker.Closed, retryIn: 18 * time.Second},
+				{at: 27 * time.Second, action: allow, allowed: true, state: breaker.Closed},
+				{at: 27 * time.Second, action: fail, state: breaker.Open, retryIn: 36 * time.Second},
+				{at: 40 * time.Second, action: allow, allowed: false, state: breaker.Open},
+			},
+			changes: []string{"closed->open"},
+		},
+		{
+			name:   "a success resets the count",
+			config: config,
+			steps: []step{
+				{at: 0, action: allow, allowed: true, state: breaker.Closed},
+				{at: 0, action: fail, state: breaker.Closed},
+				{at: 9 * time.Second, action: allow, allowed: true, state: breaker.Closed},
+				{at: 9 * time.Second, action: fail, state: breaker.Closed},
+				{at: 27 * time.Second, action: allow, allowed: true, state: breaker.Closed},
+				{at: 27 * time.Second, action: succeed, state: breaker.Closed},
+				// Straight back to the base delay.
+				{at: 30 * time.Second, action: allow, allowed: true, state: breaker.Closed},
+				{at: 30 * time.Second, action: fail, state: breaker.Closed, retryIn: 9 * time.Second},
+			},
+		},
+		{
+			name:   "half open lets a single probe through",
+			config: breaker.Config{Threshold: 1, BaseDelay: 10 * time.Second, MaxDelay: 40 * time.Second},
+			steps: []step{
+				{at: 0, action: allow, allowed: true, state: breaker.Closed},
+				{at: 0, action: fail, state: breaker.Open, retryIn: 9 * time.Second},
+				{at: 9 * time.Second, action: allow, allowed: true, state: breaker.HalfOpen},
+				// Nothing else goes through while the probe is out, however long it takes.
+				{at: 9 * time.Second, action: allow, allowed: false, state: breaker.HalfOpen},
+				{at: 20 * time.Second, action: allow, allowed: false, state: breaker.HalfOpen},
+				// The probe failed: back to open, with the delay doubled and counted from when the
+				// probe was let through.
+				{at: 20 * time.Second, action: fail, state: breaker.Open, retryIn: 18 * time.Second},
+				{at: 25 * time.Second, action: allow, allowed: false, state: breaker.Open},
+				{at: 27 * time.Second, action: allow, allowed: true, state: breaker.HalfOpen},
+				{at: 27 * time.Second, action: succeed, state: breaker.Closed},
+				{at: 27 * time.Second, action: allow, allowed: true, state: breaker.Closed},
+			},
+			changes: []string{"closed->open", "open->closed"},
+		},
+		{
+			name:   "backoff doubles up to the maximum",
+			config: breaker.Config{Threshold: 1, BaseDelay: 10 * time.Second, MaxDelay: 40 * time.Second},
+			steps: []step{
+				{at: 0, action: allow, allowed: true, state: breaker.Closed},
+				{at: 0, action: fail, state: breaker.Open, retryIn: 9 * time.Second},
+				{at: 9 * time.Second, action: allow, allowed: true, state: breaker.HalfOpen},
+				{at: 9 * time.Second, action: fail, state: breaker.Open, retryIn: 18 * time.Second},
+				{at: 27 * time.Second, action: allow, allowed: true, state: breaker.HalfOpen},
+				{at: 27 * time.Second, action: fail, state: breaker.Open, retryIn: 36 * time.Second},
+				{at: 63 * time.Second, action: allow, allowed: true, state: breaker.HalfOpen},
+				{at: 63 * time.Second, action: fail, state: breaker.Open, retryIn: 36 * time.Second},
+				{at: 99 * time.Second, action: allow, allowed: true, state: breaker.HalfOpen},
+				{at: 99 * time.Second, action: fail, state: breaker.Open, retryIn: 36 * time.Second},
+			},
+			changes: []string{"closed->open"},
+		},
+		{
+			name:   "a maximum below the base delay is raised to it",
+			config: breaker.Config{Threshold: 1, BaseDelay: 10 * time.Second, MaxDelay: time.Second},
+			steps: []step{
+				{at: 0, action: allow, allowed: true, state: breaker.Closed},
+				{at: 0, action: fail, state: breaker.Open, retryIn: 9 * time.Second},
+				{at: 9 * time.Second, action: allow, allowed: true, state: breaker.HalfOpen},
+				{at: 9 * time.Second, action: fail, state: breaker.Open, retryIn: 9 * time.Second},
+			},
+			changes: []string{"closed->open"},
+		},
+		{
+			name:   "successes while closed change nothing",
+			config: config,
+			steps: []step{
+				{at: 0, action: allow, allowed: true, state: breaker.Closed},
+				{at: 0, action: succeed, state: breaker.Closed},
+				{at: time.Second, action: allow, allowed: true, state: breaker.Closed},
+				{at: time.Second, action: succeed, state: breaker.Closed},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var changes []string
+			config := test.config
+			config.OnChange = func(from, to breaker.State, status breaker.Status) {
+				changes = append(changes, fmt.Sprintf("%s->%s", from, to))
+			}
+			b := breaker.New(config)
+			var allowedAt time.Time
+			for i, s := range test.steps {
+				now := start.Add(s.at)
+				switch s.action {
+				case allow:
+					allowed := b.Allow(now)
+					if allowed != s.allowed {
+						t.Fatalf("step %d: Allow at %s = %v, want %v", i, s.at, allowed, s.allowed)
+					}
+					if allowed {
+						allowedAt = now
+					}
+				case fail:
+					b.Failure(errors.New("timeout"))
+				case succeed:
+					b.Success()
+				}
+				status := b.Status()
+				if status.State != s.state {
+					t.Fatalf("step %d: %s at %s left the breaker %s, want %s", i, s.action, s.at, status.State, s.state)
+				}
+				if s.retryIn != 0 && status.RetryAt.Sub(allowedAt) != s.retryIn {
+					t.Fatalf("step %d: retry %s after the failed request, want %s", i, status.RetryAt.Sub(allowedAt), s.retryIn)
+				}
+			}
+			if strings.Join(changes, ",") != strings.Join(test.changes, ",") {
+				t.Errorf("OnChange calls %v, want %v", changes, test.changes)
+			}
+		})
+	}
+}
+
+// OnChange learns when the circuit opened and how often the modem failed, so the reachable event
+// can say how long the modem was gone.
+func TestStatusHandedToOnChange(t *testing.T) {
+	var opened, closed breaker.Status
+	b := breaker.New(breaker.Config{Threshold: 2, BaseDelay: 10 * time.Second, OnChange: func(from, to breaker.State, status breaker.Status) {
+		if to == breaker.Open {
+			opened = status
+		} else {
+			closed = status
+		}
+	}})
+	b.Allow(start)
+	b.Failure(errors.New("timeout"))
+	b.Allow(start.Add(9 * time.Second))
+	b.Failure(errors.New("connection refused"))
+	if opened.Failures != 2 || opened.LastError != "connection refused" || !opened.Since.Equal(start.Add(9*time.Second)) {
+		t.Errorf("status on opening: %+v", opened)
+	}
+	b.Allow(start.Add(time.Minute))
+	b.Success()
+	if closed.State != breaker.HalfOpen || closed.Failures != 2 || !closed.Since.Equal(opened.Since) {
+		t.Errorf("status on closing: %+v, want the half open status from before", closed)
+	}
+	if status := b.Status(); status.State != breaker.Closed || status.Failures != 0 || status.LastError != "" {
+		t.Errorf("status after closing: %+v, want closed and cleared", status)
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *breaker.Breaker
+	if state := b.Status().State; state != breaker.Closed {
+		t.Errorf("nil breaker is %s, want closed", state)
+	}
+}
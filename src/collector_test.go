@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/breaker"
+	"github.com/RickyGrassmuck/modem_logs/events"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/modem/mb8611/simulator"
+	"github.com/RickyGrassmuck/modem_logs/outages"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+)
+
+// Keeps everything the dispatcher hands it.
+type memorySink struct {
+	mutex     sync.Mutex
+	snapshots []*snapshot.Snapshot
+	events    []*events.Event
+	logs      []modem.LogEntry
+}
+
+func (s *memorySink) Name() string { return "memory" }
+func (s *memorySink) Close() error { return nil }
+
+func (s *memorySink) WriteSnapshot(snap *snapshot.Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshots = append(s.snapshots, snap)
+	return nil
+}
+
+func (s *memorySink) WriteEvent(e *events.Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memorySink) WriteLogEntries(batch *sinks.LogBatch) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.logs = append(s.logs, batch.New...)
+	return nil
+}
+
+// The number of snapshots and the types of the events received so far.
+func (s *memorySink) received() (int, []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var types []string
+	for _, e := range s.events {
+		types = append(types, e.Type)
+	}
+	return len(s.snapshots), types
+}
+
+// A collector polling the simulator, the way collect sets it up, with a breaker that opens on the
+// first failure and an outage journal.
+func newTestCollector(t *testing.T) (*Config, *simulator.TestServer, *clock, *memorySink) {
+	t.Helper()
+	now := &clock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	config := simulator.DefaultConfig()
+	config.Now = now.Now
+	server := simulator.NewTestServer(config)
+	t.Cleanup(server.Close)
+
+	client, err := modem.NewClient(server.Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.Timeout = 5 * time.Second
+	if _, err := client.Login(config.Username, config.Password); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{
+		ModemConfig: client,
+		ModemName:   defaultModemName,
+		Now:         now.Now,
+		Journal:     outages.NewJournal(filepath.Join(t.TempDir(), "journal.jsonl"), 0),
+	}
+	if c.Thresholds, err = thresholds.Load("docsis", ""); err != nil {
+		t.Fatal(err)
+	}
+	c.Breaker = breaker.New(breaker.Config{Threshold: 1, OnChange: c.reachabilityChanged})
+	sink := &memorySink{}
+	c.startSinks([]sinks.Sink{sink}, true)
+	t.Cleanup(c.Sinks.Close)
+	return c, server, now, sink
+}
+
+func TestCollectorThroughAuthFailureAndReboot(t *testing.T) {
+	c, server, now, sink := newTestCollector(t)
+	config := server.Simulator.Config()
+	check := func(step string, wantSnapshots int, wantEvents ...string) {
+		t.Helper()
+		c.Sinks.Drain()
+		snapshots, types := sink.received()
+		if snapshots != wantSnapshots || strings.Join(types, ",") != strings.Join(wantEvents, ",") {
+			t.Fatalf("%s: %d snapshots and events %v, want %d snapshots and events %v",
+				step, snapshots, types, wantSnapshots, wantEvents)
+		}
+	}
+
+	c.refreshDeviceInfo()
+	c.refreshLogEntries()
+	c.collectStats()
+	check("first poll", 1)
+	if snap := sink.snapshots[0]; snap.DeviceInfo == nil || snap.Health == nil || snap.Report == nil {
+		t.Fatalf("first snapshot lacks the device info, health or report: %+v", snap)
+	}
+
+	// The session is dropped and logging in again is rejected as well.
+	server.Simulator.Inject(simulator.FailureAuth, 2)
+	now.Advance(10 * time.Second)
+	c.collectStats()
+	check("rejected login", 1, events.ModemUnreachable)
+	if status := c.Breaker.Status(); status.State != breaker.Open || !strings.Contains(status.LastError, "rejected") {
+		t.Errorf("breaker after the rejected login: %+v, want open with the rejection", status)
+	}
+
+	now.Advance(10 * time.Second)
+	c.collectStats()
+	check("logged in again", 2, events.ModemUnreachable, events.ModemReachable)
+
+	server.Simulator.Reboot()
+	now.Advance(10 * time.Second)
+	c.collectStats()
+	check("while rebooting", 2, events.ModemUnreachable, events.ModemReachable, events.ModemUnreachable)
+
+	now.Advance(config.RebootDowntime + config.LockDelay)
+	c.collectStats()
+	c.refreshLogEntries()
+	check("after the reboot", 3, events.ModemUnreachable, events.ModemReachable, events.ModemUnreachable,
+		events.ModemReachable, events.ModemRebooted)
+	rebootLogged := false
+	for _, entry := range sink.logs {
+		rebootLogged = rebootLogged || strings.HasPrefix(entry.Message, "Cable Modem Reboot because of")
+	}
+	if !rebootLogged {
+		t.Error("the reboot's log entry was not forwarded")
+	}
+
+	observations, _, err := c.Journal.Read(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reachable []bool
+	for _, obs := range observations {
+		reachable = append(reachable, obs.Reachable)
+	}
+	if want := []bool{true, false, true, false, true}; fmt.Sprint(reachable) != fmt.Sprint(want) {
+		t.Errorf("journaled polls reachable %v, want %v", reachable, want)
+	}
+}
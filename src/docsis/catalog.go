@@ -0,0 +1,138 @@
+package docsis
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	CategoryRanging      = "ranging"
+	CategorySync         = "sync"
+	CategoryProvisioning = "provisioning"
+	CategoryDHCP         = "dhcp"
+	CategorySecurity     = "security"
+	CategoryReboot       = "reboot"
+	CategoryStatus       = "status"
+	CategoryOther        = "other"
+)
+
+// The classification of a modem log message. ID and Code are the DOCSIS OSSI event ID and
+// numeric event code; both are empty for messages the catalog does not know.
+type Classification struct {
+	ID       string `json:"id,omitempty"`
+	Code     int    `json:"code,omitempty"`
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+func (c Classification) Known() bool {
+	return c.ID != ""
+}
+
+type catalogEntry struct {
+	pattern *regexp.Regexp
+	Classification
+}
+
+// Ordered from most to least specific; the first match wins.
+var catalog = []catalogEntry{
+	{regexp.MustCompile(`(?i)16 consecutive T3 timeouts`), Classification{"R08.0", 82000800, CategoryRanging, "critical",
+		"The modem gave up on an upstream channel after repeated ranging failures. Usually upstream noise or a failing return path; check cabling and splitters, then ask the ISP to check the node."}},
+	{regexp.MustCompile(`(?i)Started Unicast Maintenance Ranging.*T3 time-out`), Classification{"R05.0", 82000500, CategoryRanging, "critical",
+		"The CMTS stopped answering periodic ranging on an upstream channel. Occasional entries are normal; bursts point to upstream ingress or high upstream power."}},
+	{regexp.MustCompile(`(?i)No Ranging Response received.*T3 time-out`), Classification{"R02.0", 82000200, CategoryRanging, "critical",
+		"The CMTS did not answer a ranging request. Frequent T3 time-outs usually mean upstream noise, loose connectors or upstream power near the limit."}},
+	{regexp.MustCompile(`(?i)Unicast Maintenance Ranging attempted.*Retries exhausted`), Classification{"R06.0", 82000600, CategoryRanging, "error",
+		"Periodic ranging on an upstream channel failed repeatedly and the modem will reinitialize. Check upstream power and cabling."}},
+	{regexp.MustCompile(`(?i)Retries exhausted`), Classification{"R03.0", 82000300, CategoryRanging, "error",
+		"Unicast ranging failed repeatedly and the modem will reinitialize. Check upstream power and cabling."}},
+	{regexp.MustCompile(`(?i)T4 time.?out`), Classification{"R04.0", 82000400, CategoryRanging, "critical",
+		"The modem received no maintenance opportunities and will reset its MAC. Usually a CMTS-side or severe plant problem; report it to the ISP if it repeats."}},
+	{regexp.MustCompile(`(?i)Received Abort Response`), Classification{"R07.0", 82000700, CategoryRanging, "error",
+		"The CMTS told the modem to abort ranging and reinitialize. Often follows large upstream power adjustments."}},
+	{regexp.MustCompile(`(?i)Dynamic Range Window violation|Top of the DRW`), Classification{"R10.0", 82001000, CategoryRanging, "warning",
+		"Upstream channels are being asked to transmit outside the allowed power window. Upstream attenuation is probably too high."}},
+	{regexp.MustCompile(`(?i)No Maintenance Broadcasts for Ranging opportunities.*T2 time-out`), Classification{"R01.0", 82000100, CategoryRanging, "critical",
+		"The modem heard no ranging opportunities on an upstream channel. Usually a CMTS-side problem or a downstream too impaired to carry the maps."}},
+	{regexp.MustCompile(`(?i)Failed to acquire QAM/QPSK symbol timing`), Classification{"T01.0", 84000100, CategorySync, "critical",
+		"The modem could not lock onto a downstream channel. Check downstream power and SNR, and look for damaged coax or splitters."}},
+	{regexp.MustCompile(`(?i)Failed to acquire FEC framing`), Classification{"T02.0", 84000200, CategorySync, "critical",
+		"The downstream signal is present but too impaired to decode. Usually low SNR or ingress on the downstream."}},
+	{regexp.MustCompile(`(?i)Failed to acquire MPEG2 Sync`), Classification{"T03.0", 84000300, CategorySync, "critical",
+		"Downstream framing was acquired but the transport stream was not. Usually severe downstream impairment."}},
+	{regexp.MustCompile(`(?i)SYNC Timing Synchronization failure.*Loss of Sync`), Classification{"T05.0", 84000500, CategorySync, "critical",
+		"The modem lost downstream synchronization. Repeated entries point to intermittent downstream signal problems."}},
+	{regexp.MustCompile(`(?i)SYNC Timing Synchronization failure`), Classification{"T01.0", 84000100, CategorySync, "critical",
+		"The modem lost or could not acquire downstream timing. Check downstream signal levels and the coax path."}},
+	{regexp.MustCompile(`(?i)Lost MDD Timeout`), Classification{"T202.0", 84020200, CategorySync, "warning",
+		"The modem stopped receiving MAC domain descriptors on its primary downstream. Brief occurrences are common; frequent ones suggest downstream impairment."}},
+	{regexp.MustCompile(`(?i)DHCP FAILED - Discover sent, no offer received`), Classification{"D01.0", 68000100, CategoryDHCP, "critical",
+		"The ISP's provisioning server did not answer. Usually an ISP-side outage or an unprovisioned modem."}},
+	{regexp.MustCompile(`(?i)DHCP FAILED - Request sent, No response`), Classification{"D03.0", 68000300, CategoryDHCP, "critical",
+		"The ISP's DHCP server stopped responding mid-exchange. Usually an ISP-side issue."}},
+	{regexp.MustCompile(`(?i)DHCP RENEW sent - No response`), Classification{"D101.0", 68010100, CategoryDHCP, "error",
+		"A lease renewal went unanswered. Harmless if it succeeds later; repeated failures precede loss of connectivity."}},
+	{regexp.MustCompile(`(?i)DHCP RENEW WARNING`), Classification{"D103.0", 68010300, CategoryDHCP, "warning",
+		"The ISP's renewal response contained an unexpected field. Normally harmless and not actionable."}},
+	{regexp.MustCompile(`(?i)TFTP failed`), Classification{"D05.0", 68000500, CategoryProvisioning, "critical",
+		"The modem could not download its configuration file. Usually an ISP provisioning problem."}},
+	{regexp.MustCompile(`(?i)ToD request sent - No Response`), Classification{"D04.1", 68000401, CategoryProvisioning, "warning",
+		"The ISP's time server did not answer. Log timestamps may be missing until it does; otherwise harmless."}},
+	{regexp.MustCompile(`(?i)REG RSP not received|Registration.*fail`), Classification{"I02.0", 73000200, CategoryProvisioning, "critical",
+		"Registration with the CMTS failed. Usually an ISP provisioning problem."}},
+	{regexp.MustCompile(`(?i)Auth Reject|Unauthorized SAID|BPI\+?.*(fail|reject|invalid)`), Classification{"B301.2", 66030102, CategorySecurity, "error",
+		"Baseline privacy authorization failed. The ISP may not recognize the modem's certificate; contact them if service is affected."}},
+	{regexp.MustCompile(`(?i)Cable Modem Reboot`), Classification{"Z00.1", 0, CategoryReboot, "notice",
+		"The modem restarted; the message states why (power reset, user request, firmware upgrade)."}},
+	{regexp.MustCompile(`(?i)CM-STATUS message sent`), Classification{"M571.0", 85057100, CategoryStatus, "notice",
+		"The modem reported a channel state change (for example an OFDM profile or lock change) to the CMTS."}},
+	{regexp.MustCompile(`(?i)profile assignment change`), Classification{"M580.0", 0, CategoryStatus, "notice",
+		"The CMTS moved an OFDM/OFDMA channel to a different modulation profile, usually because of changing signal quality."}},
+	{regexp.MustCompile(`(?i)Honoring MDD|IP provisioning mode`), Classification{"", 0, CategoryProvisioning, "information", ""}},
+}
+
+var priorityNames = map[int]string{
+	1: "emergency",
+	2: "alert",
+	3: "critical",
+	4: "error",
+	5: "warning",
+	6: "notice",
+	7: "information",
+	8: "debug",
+}
+
+// Classify a log message. Messages the catalog does not know get a category guessed from
+// keywords and a severity taken from the modem's priority (1 emergency .. 8 debug).
+func Classify(message string, priority int) Classification {
+	for _, entry := range catalog {
+		if entry.pattern.MatchString(message) {
+			return entry.Classification
+		}
+	}
+	severity, ok := priorityNames[priority]
+	if !ok {
+		severity = "information"
+	}
+	return Classification{Category: guessCategory(message), Severity: severity}
+}
+
+func guessCategory(message string) string {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "ranging") || strings.Contains(message, "rng-"):
+		return CategoryRanging
+	case strings.Contains(message, "sync") || strings.Contains(message, "mdd"):
+		return CategorySync
+	case strings.Contains(message, "dhcp"):
+		return CategoryDHCP
+	case strings.Contains(message, "tftp") || strings.Contains(message, "config file") || strings.Contains(message, "reg-") || strings.Contains(message, "registration"):
+		return CategoryProvisioning
+	case strings.Contains(message, "bpi") || strings.Contains(message, "auth") || strings.Contains(message, "certificate"):
+		return CategorySecurity
+	case strings.Contains(message, "reboot") || strings.Contains(message, "reset"):
+		return CategoryReboot
+	}
+	return CategoryOther
+}
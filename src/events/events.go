@@ -0,0 +1,49 @@
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	FirmwareChanged  = "firmware_changed"
+	ModemRebooted    = "modem_rebooted"
+	ModemRecovered   = "modem_recovered"
+	ModemUnreachable = "modem_unreachable"
+	ModemReachable   = "modem_reachable"
+	LagChanged       = "lag_changed"
+	AlertFiring      = "alert_firing"
+	AlertResolved    = "alert_resolved"
+)
+
+type Event struct {
+	Time    time.Time
+	Modem   string
+	Type    string
+	Message string
+	Fields  map[string]string
+}
+
+func New(modem, eventType, message string) *Event {
+	return NewAt(time.Now(), modem, eventType, message)
+}
+
+// NewAt creates an event that happened at the given time.
+func NewAt(at time.Time, modem, eventType, message string) *Event {
+	return &Event{
+		Time:    at.UTC(),
+		Modem:   modem,
+		Type:    eventType,
+		Message: message,
+		Fields:  map[string]string{},
+	}
+}
+
+func (e *Event) WithField(key, value string) *Event {
+	e.Fields[key] = value
+	return e
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("[%s] %s: %s", e.Modem, e.Type, e.Message)
+}
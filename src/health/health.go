@@ -0,0 +1,135 @@
+package health
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+)
+
+// Maximum number of points each factor can take off the score.
+const (
+	maxLockPenalty          = 40
+	maxMarginPenalty        = 25
+	maxUncorrectablePenalty = 15
+	maxTimeoutPenalty       = 15
+	maxUptimePenalty        = 5
+)
+
+const (
+	FactorChannelLock   = "channel_lock"
+	FactorSignalMargin  = "signal_margin"
+	FactorUncorrectable = "uncorrectables"
+	FactorTimeouts      = "t3_t4_timeouts"
+	FactorUptime        = "uptime"
+)
+
+var FactorNames = []string{FactorChannelLock, FactorSignalMargin, FactorUncorrectable, FactorTimeouts, FactorUptime}
+
+// Catalog event IDs of the T3 and T4 time-out messages.
+var timeoutEvents = map[string]bool{"R02.0": true, "R04.0": true, "R05.0": true, "R08.0": true}
+
+// How far back T3/T4 time-outs count against the score.
+const TimeoutWindow = time.Hour
+
+type Input struct {
+	Connection           *modem.Connection
+	Report               *thresholds.Report
+	UncorrectedPerMinute float64
+	LogEntries           []modem.LogEntry
+	Now                  time.Time
+}
+
+type Factor struct {
+	Name    string
+	Penalty float64
+	Detail  string
+}
+
+type Score struct {
+	Value   float64
+	Factors []Factor
+}
+
+// Compute a 0-100 score for a snapshot. Factors lists every input that lowered the score,
+// largest penalty first.
+func Compute(in Input) *Score {
+	score := &Score{Value: 100}
+
+	total, locked := 0, 0
+	for _, channels := range []modem.ConnectionDetails{in.Connection.Downstream, in.Connection.Upstream} {
+		total += len(channels.ToCSV())
+		locked += channels.LockedCount()
+	}
+	if total == 0 {
+		score.add(FactorChannelLock, maxLockPenalty, "no channels reported")
+	} else if locked < total {
+		ratio := float64(locked) / float64(total)
+		score.add(FactorChannelLock, (1-ratio)*maxLockPenalty, fmt.Sprintf("%d of %d channels locked", locked, total))
+	}
+
+	if in.Report != nil {
+		verdicts := map[thresholds.Verdict]int{}
+		for _, v := range in.Report.Downstream {
+			verdicts[v.Verdict]++
+		}
+		for _, v := range in.Report.Upstream {
+			verdicts[v.Verdict]++
+		}
+		if graded := len(in.Report.Downstream) + len(in.Report.Upstream); graded > 0 {
+			penalty := (float64(verdicts[thresholds.Bad]) + 0.4*float64(verdicts[thresholds.Marginal])) / float64(graded) * maxMarginPenalty
+			score.add(FactorSignalMargin, penalty, fmt.Sprintf("%d bad, %d marginal of %d channels",
+				verdicts[thresholds.Bad], verdicts[thresholds.Marginal], graded))
+		}
+	}
+
+	if in.UncorrectedPerMinute > 0 {
+		// Three points, plus three more per order of magnitude above one codeword a minute.
+		penalty := math.Min(maxUncorrectablePenalty, 3*(1+math.Log10(math.Max(in.UncorrectedPerMinute, 1))))
+		score.add(FactorUncorrectable, penalty, fmt.Sprintf("%.1f uncorrectable codewords/min", in.UncorrectedPerMinute))
+	}
+
+	timeouts := 0
+	for _, entry := range in.LogEntries {
+		if entry.Time.IsZero() || in.Now.Sub(entry.Time) > TimeoutWindow {
+			continue
+		}
+		if timeoutEvents[entry.Event.ID] {
+			timeouts++
+		}
+	}
+	if timeouts > 0 {
+		score.add(FactorTimeouts, math.Min(maxTimeoutPenalty, 3*float64(timeouts)),
+			fmt.Sprintf("%d T3/T4 time-outs in the last %s", timeouts, TimeoutWindow))
+	}
+
+	if uptime := in.Connection.UptimeDuration(); in.Connection.Uptime != "" && uptime < time.Hour {
+		score.add(FactorUptime, maxUptimePenalty*(1-uptime.Hours()), fmt.Sprintf("up for only %s", uptime))
+	}
+
+	sort.Slice(score.Factors, func(i, j int) bool { return score.Factors[i].Penalty > score.Factors[j].Penalty })
+	score.Value = math.Max(0, math.Round(score.Value*10)/10)
+	return score
+}
+
+// Penalty returns the points the named factor took off the score, or zero.
+func (s *Score) Penalty(name string) float64 {
+	for _, f := range s.Factors {
+		if f.Name == name {
+			return f.Penalty
+		}
+	}
+	return 0
+}
+
+func (s *Score) add(name string, penalty float64, detail string) {
+	if penalty <= 0 {
+		return
+	}
+	penalty = math.Round(penalty*10) / 10
+	s.Factors = append(s.Factors, Factor{Name: name, Penalty: penalty, Detail: detail})
+	s.Value -= penalty
+}
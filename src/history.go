@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/history"
+	"github.com/RickyGrassmuck/modem_logs/utils"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+type historyResult struct {
+	Modem   string           `json:"modem"`
+	Series  string           `json:"series"`
+	Channel int              `json:"channel,omitempty"`
+	Field   string           `json:"field"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Step    string           `json:"step"`
+	Buckets []history.Bucket `json:"buckets"`
+	Compare *historyCompare  `json:"compare,omitempty"`
+}
+
+type historyCompare struct {
+	Offset  string           `json:"offset"`
+	Buckets []history.Bucket `json:"buckets"`
+}
+
+func (r *historyResult) title() string {
+	if r.Series == history.SeriesSnapshot {
+		return fmt.Sprintf("%s (%s)", r.Field, r.Modem)
+	}
+	return fmt.Sprintf("%s channel %d %s (%s)", r.Series, r.Channel, r.Field, r.Modem)
+}
+
+func formatStat(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+func printHistory(result *historyResult, offset time.Duration) {
+	historyTable := table.NewWriter()
+	historyTable.SetTitle("%s, %s STEPS", result.title(), result.Step)
+	historyTable.SetStyle(table.StyleLight)
+	historyTable.Style().Title.Align = text.AlignCenter
+	historyTable.SetOutputMirror(os.Stdout)
+
+	header := table.Row{"Bucket", "Samples", "Min", "Max", "Avg", "P95"}
+	var previous map[time.Time]history.Bucket
+	if result.Compare != nil {
+		label := "-" + result.Compare.Offset
+		header = append(header, "Samples "+label, "Min "+label, "Max "+label, "Avg "+label, "P95 "+label, "Δ Avg")
+		previous = map[time.Time]history.Bucket{}
+		for _, b := range result.Compare.Buckets {
+			previous[b.Start.Add(offset)] = b
+		}
+	}
+	historyTable.AppendHeader(header)
+	var columns []table.ColumnConfig
+	for i := 2; i <= len(header); i++ {
+		columns = append(columns, table.ColumnConfig{Number: i, Align: text.AlignRight})
+	}
+	historyTable.SetColumnConfigs(columns)
+	for _, b := range result.Buckets {
+		row := table.Row{b.Start.Local().Format("2006-01-02 15:04"), b.Samples,
+			formatStat(b.Min), formatStat(b.Max), formatStat(b.Avg), formatStat(b.P95)}
+		if previous != nil {
+			if p, ok := previous[b.Start]; ok {
+				row = append(row, p.Samples, formatStat(p.Min), formatStat(p.Max), formatStat(p.Avg), formatStat(p.P95),
+					fmt.Sprintf("%+.2f", b.Avg-p.Avg))
+			} else {
+				row = append(row, "", "", "", "", "", "")
+			}
+		}
+		historyTable.AppendRow(row)
+	}
+	historyTable.Render()
+}
+
+func runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	dbPath := flags.String("db", defaultHistoryFileName, "history database written by the collector (default $HISTORY_DB)")
+	modemName := flags.String("modem", defaultModemName, "modem name the history was recorded under (default $MODEM_NAME)")
+	channel := flags.Int("channel", 0, "channel number; without it --field names an aggregate series")
+	direction := flags.String("direction", history.DirectionDownstream, "channel direction, downstream or upstream")
+	field := flags.String("field", "", fmt.Sprintf("channel field %v or aggregate field %v", history.ChannelFields(), history.SnapshotFields()))
+	sinceFlag := flags.String("since", "24h", "start of the window, e.g. 24h, 30d or 2026-01-01")
+	untilFlag := flags.String("until", "", "end of the window (default now)")
+	stepFlag := flags.String("step", "1h", "bucket size, e.g. 5m, 1h or 1d")
+	compareFlag := flags.String("compare", "", "also show the window this far back, e.g. 7d, side by side")
+	asJSON := flags.Bool("json", false, "print JSON instead of a table")
+	flags.Parse(args)
+	if envDB, ok := os.LookupEnv("HISTORY_DB"); ok && !flagWasSet(flags, "db") {
+		*dbPath = envDB
+	}
+	if envModem, ok := os.LookupEnv("MODEM_NAME"); ok && !flagWasSet(flags, "modem") {
+		*modemName = envModem
+	}
+
+	fail := func(err error) {
+		logger.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	now := time.Now().UTC()
+	since, err := utils.ParseSince(*sinceFlag, now)
+	if err != nil {
+		fail(err)
+	}
+	until := now
+	if *untilFlag != "" {
+		if until, err = utils.ParseSince(*untilFlag, now); err != nil {
+			fail(err)
+		}
+	}
+	step, err := utils.ParseDuration(*stepFlag)
+	if err != nil {
+		fail(fmt.Errorf("invalid step %q: %w", *stepFlag, err))
+	}
+	var offset time.Duration
+	if *compareFlag != "" {
+		if offset, err = utils.ParseDuration(*compareFlag); err != nil {
+			fail(fmt.Errorf("invalid comparison offset %q: %w", *compareFlag, err))
+		}
+		if step <= 0 || offset%step != 0 {
+			fail(fmt.Errorf("the comparison offset must be a multiple of the step"))
+		}
+	}
+	if _, err := os.Stat(*dbPath); err != nil {
+		fail(err)
+	}
+
+	store, err := history.Open(history.Config{Path: *dbPath})
+	if err != nil {
+		fail(err)
+	}
+	defer store.Close()
+
+	query := history.Query{Modem: *modemName, Series: history.SeriesSnapshot, Field: *field, From: since, To: until, Step: step}
+	if flagWasSet(flags, "channel") {
+		query.Series, query.Channel = *direction, *channel
+	}
+	result := &historyResult{Modem: query.Modem, Series: query.Series, Channel: query.Channel, Field: query.Field,
+		From: since, To: until, Step: *stepFlag}
+	if result.Buckets, err = store.Query(query); err != nil {
+		fail(err)
+	}
+	if offset > 0 {
+		query.From, query.To = since.Add(-offset), until.Add(-offset)
+		compare := &historyCompare{Offset: *compareFlag}
+		if compare.Buckets, err = store.Query(query); err != nil {
+			fail(err)
+		}
+		result.Compare = compare
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+		return
+	}
+	printHistory(result, offset)
+}
@@ -0,0 +1,110 @@
+package history
+
+import "fmt"
+
+// Schema migrations, applied in order. Never edit a released migration; append a new one.
+// Times are stored as Unix seconds.
+var migrations = []string{
+	`CREATE TABLE snapshots (
+		id                 INTEGER PRIMARY KEY,
+		time               INTEGER NOT NULL,
+		modem              TEXT NOT NULL,
+		connectivity       TEXT,
+		boot_status        TEXT,
+		config_file_status TEXT,
+		uptime             INTEGER,
+		health             REAL,
+		locked_downstream  INTEGER,
+		total_downstream   INTEGER,
+		locked_upstream    INTEGER,
+		total_upstream     INTEGER,
+		total_corrected    INTEGER,
+		total_uncorrected  INTEGER,
+		power_spread       REAL
+	);
+	CREATE INDEX snapshots_modem_time ON snapshots (modem, time);
+
+	CREATE TABLE channels (
+		snapshot_id INTEGER NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+		time        INTEGER NOT NULL,
+		modem       TEXT NOT NULL,
+		direction   TEXT NOT NULL,
+		channel     INTEGER NOT NULL,
+		type        TEXT NOT NULL,
+		lock_status TEXT,
+		modulation  TEXT,
+		channel_id  INTEGER,
+		frequency   REAL,
+		power       REAL,
+		snr         REAL,
+		corrected   INTEGER,
+		uncorrected INTEGER,
+		symbol_rate INTEGER,
+		verdict     TEXT
+	);
+	CREATE INDEX channels_snapshot ON channels (snapshot_id);
+	CREATE INDEX channels_modem_channel_time ON channels (modem, direction, channel, time);
+
+	CREATE TABLE log_entries (
+		time     INTEGER,
+		recorded INTEGER NOT NULL,
+		modem    TEXT NOT NULL,
+		priority INTEGER,
+		message  TEXT NOT NULL,
+		event_id TEXT,
+		category TEXT,
+		severity TEXT,
+		UNIQUE (modem, time, message)
+	);
+	CREATE INDEX log_entries_modem_recorded ON log_entries (modem, recorded);
+
+	CREATE TABLE rollups (
+		hour    INTEGER NOT NULL,
+		modem   TEXT NOT NULL,
+		series  TEXT NOT NULL,
+		channel INTEGER NOT NULL,
+		field   TEXT NOT NULL,
+		samples INTEGER NOT NULL,
+		min     REAL,
+		max     REAL,
+		avg     REAL,
+		p95     REAL,
+		PRIMARY KEY (modem, series, channel, field, hour)
+	);`,
+	// Entries logged before the modem learned the time of day have a NULL time, and NULLs never
+	// conflict in a UNIQUE constraint, so they were stored again on every restart.
+	`DELETE FROM log_entries WHERE time IS NULL AND rowid NOT IN (
+		SELECT MIN(rowid) FROM log_entries WHERE time IS NULL GROUP BY modem, message);
+	CREATE UNIQUE INDEX log_entries_modem_time_message ON log_entries (modem, COALESCE(time, 0), message);`,
+}
+
+func (s *Store) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	var version int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d)", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// A series is either a single channel (Series is a direction) or an aggregate field of
+// SeriesSnapshot, in which case Channel is ignored.
+type Query struct {
+	Modem   string
+	Series  string
+	Channel int
+	Field   string
+	From    time.Time
+	To      time.Time
+	Step    time.Duration
+}
+
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Stats
+}
+
+func ChannelFields() []string  { return append([]string(nil), channelFields...) }
+func SnapshotFields() []string { return append([]string(nil), snapshotFields...) }
+
+func (q Query) validate() error {
+	fields := channelFields
+	switch q.Series {
+	case DirectionDownstream, DirectionUpstream:
+	case SeriesSnapshot:
+		fields = snapshotFields
+	default:
+		return fmt.Errorf("unknown series %q", q.Series)
+	}
+	for _, f := range fields {
+		if f == q.Field {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %s field %q, expected one of %v", q.Series, q.Field, fields)
+}
+
+// Run the query and return one bucket per step in [From, To) that has samples. Buckets are
+// aligned to multiples of Step since the Unix epoch. Raw rows are summarized exactly; hours
+// that were already rolled up are merged from their rollups, which makes P95 of such buckets
+// the largest hourly P95 rather than an exact percentile.
+func (s *Store) Query(q Query) ([]Bucket, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	step := int64(q.Step.Seconds())
+	if step < 1 {
+		return nil, fmt.Errorf("step must be at least one second")
+	}
+	bucketOf := func(t int64) int64 { return t - t%step }
+	from, to := q.From.Unix(), q.To.Unix()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	raw := map[int64][]float64{}
+	var sqlQuery string
+	var args []interface{}
+	if q.Series == SeriesSnapshot {
+		// Field names are validated above, so interpolating them is safe.
+		sqlQuery = fmt.Sprintf(`SELECT time, %s FROM snapshots WHERE modem = ? AND time >= ? AND time < ? AND %s IS NOT NULL`, q.Field, q.Field)
+		args = []interface{}{q.Modem, from, to}
+	} else {
+		sqlQuery = fmt.Sprintf(`SELECT time, %s FROM channels WHERE modem = ? AND direction = ? AND channel = ?
+			AND time >= ? AND time < ? AND %s IS NOT NULL`, q.Field, q.Field)
+		args = []interface{}{q.Modem, q.Series, q.Channel, from, to}
+	}
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var t int64
+		var value float64
+		if err := rows.Scan(&t, &value); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		raw[bucketOf(t)] = append(raw[bucketOf(t)], value)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	channel := q.Channel
+	if q.Series == SeriesSnapshot {
+		channel = 0
+	}
+	rolled := map[int64][]Stats{}
+	rows, err = s.db.Query(`SELECT hour, samples, min, max, avg, p95 FROM rollups
+		WHERE modem = ? AND series = ? AND channel = ? AND field = ? AND hour >= ? AND hour < ?`,
+		q.Modem, q.Series, channel, q.Field, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var hour int64
+		var stats Stats
+		if err := rows.Scan(&hour, &stats.Samples, &stats.Min, &stats.Max, &stats.Avg, &stats.P95); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rolled[bucketOf(hour)] = append(rolled[bucketOf(hour)], stats)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	starts := map[int64]bool{}
+	for start := range raw {
+		starts[start] = true
+	}
+	for start := range rolled {
+		starts[start] = true
+	}
+	var buckets []Bucket
+	for start := range starts {
+		parts := rolled[start]
+		if values := raw[start]; len(values) > 0 {
+			parts = append(parts, Summarize(values))
+		}
+		buckets = append(buckets, Bucket{Start: time.Unix(start, 0).UTC(), Stats: merge(parts)})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets, nil
+}
+
+func merge(parts []Stats) Stats {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	merged := Stats{Min: math.Inf(1), Max: math.Inf(-1), P95: math.Inf(-1)}
+	sum := 0.0
+	for _, p := range parts {
+		merged.Samples += p.Samples
+		merged.Min = math.Min(merged.Min, p.Min)
+		merged.Max = math.Max(merged.Max, p.Max)
+		merged.P95 = math.Max(merged.P95, p.P95)
+		sum += p.Avg * float64(p.Samples)
+	}
+	merged.Avg = sum / float64(merged.Samples)
+	return merged
+}
@@ -0,0 +1,169 @@
+package history
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// The rollup series holding the per-snapshot aggregate fields; its channel is always 0.
+const SeriesSnapshot = "snapshot"
+
+var channelFields = []string{"power", "snr", "corrected", "uncorrected"}
+
+var snapshotFields = []string{"health", "locked_downstream", "locked_upstream", "total_corrected",
+	"total_uncorrected", "power_spread", "uptime"}
+
+// Summary statistics of a set of samples.
+type Stats struct {
+	Samples int     `json:"samples"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Avg     float64 `json:"avg"`
+	P95     float64 `json:"p95"`
+}
+
+func Summarize(values []float64) Stats {
+	if len(values) == 0 {
+		return Stats{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	// Nearest-rank percentile.
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return Stats{
+		Samples: len(sorted),
+		Min:     sorted[0],
+		Max:     sorted[len(sorted)-1],
+		Avg:     sum / float64(len(sorted)),
+		P95:     sorted[rank],
+	}
+}
+
+type rollupKey struct {
+	modem   string
+	series  string
+	channel int
+	field   string
+}
+
+// Fold raw rows older than the raw retention into hourly rollups one hour at a time, then
+// delete rollups and log entries past their retention. Only whole hours are rolled up, so
+// running this more often than hourly is cheap.
+func (s *Store) Maintain(now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.config.RawRetention > 0 {
+		cutoff := now.Add(-s.config.RawRetention).Truncate(time.Hour).Unix()
+		for {
+			var oldest sql.NullInt64
+			if err := s.db.QueryRow(`SELECT MIN(time) FROM snapshots WHERE time < ?`, cutoff).Scan(&oldest); err != nil {
+				return err
+			}
+			if !oldest.Valid {
+				break
+			}
+			hour := oldest.Int64 - oldest.Int64%3600
+			if err := s.rollupHour(hour); err != nil {
+				return err
+			}
+		}
+	}
+	if s.config.RollupRetention > 0 {
+		if _, err := s.db.Exec(`DELETE FROM rollups WHERE hour < ?`, now.Add(-s.config.RollupRetention).Unix()); err != nil {
+			return err
+		}
+	}
+	if s.config.LogRetention > 0 {
+		if _, err := s.db.Exec(`DELETE FROM log_entries WHERE recorded < ?`, now.Add(-s.config.LogRetention).Unix()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) rollupHour(hour int64) error {
+	end := hour + 3600
+	values := map[rollupKey][]float64{}
+
+	rows, err := s.db.Query(`SELECT modem, direction, channel, power, snr, corrected, uncorrected
+		FROM channels WHERE time >= ? AND time < ?`, hour, end)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var modemName, direction string
+		var channel int
+		var power, snr, corrected, uncorrected sql.NullFloat64
+		if err := rows.Scan(&modemName, &direction, &channel, &power, &snr, &corrected, &uncorrected); err != nil {
+			rows.Close()
+			return err
+		}
+		for i, value := range []sql.NullFloat64{power, snr, corrected, uncorrected} {
+			if value.Valid {
+				key := rollupKey{modemName, direction, channel, channelFields[i]}
+				values[key] = append(values[key], value.Float64)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = s.db.Query(`SELECT modem, health, locked_downstream, locked_upstream, total_corrected,
+		total_uncorrected, power_spread, uptime FROM snapshots WHERE time >= ? AND time < ?`, hour, end)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var modemName string
+		fields := make([]sql.NullFloat64, len(snapshotFields))
+		dest := []interface{}{&modemName}
+		for i := range fields {
+			dest = append(dest, &fields[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return err
+		}
+		for i, value := range fields {
+			if value.Valid {
+				key := rollupKey{modemName, SeriesSnapshot, 0, snapshotFields[i]}
+				values[key] = append(values[key], value.Float64)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for key, samples := range values {
+		stats := Summarize(samples)
+		_, err := tx.Exec(`INSERT OR REPLACE INTO rollups (hour, modem, series, channel, field, samples, min, max, avg, p95)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, hour, key.modem, key.series, key.channel, key.field,
+			stats.Samples, stats.Min, stats.Max, stats.Avg, stats.P95)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM channels WHERE time >= ? AND time < ?`, hour, end); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM snapshots WHERE time >= ? AND time < ?`, hour, end); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
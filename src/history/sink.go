@@ -0,0 +1,30 @@
+package history
+
+import (
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/events"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+)
+
+func (s *Store) Name() string { return "history" }
+
+// Save the snapshot and roll up old rows once an hour, going by the snapshot times so that
+// reprocessed and replayed snapshots are maintained on their own clock.
+func (s *Store) WriteSnapshot(snap *snapshot.Snapshot) error {
+	if err := s.SaveSnapshot(snap); err != nil {
+		return err
+	}
+	if snap.Time.Sub(s.lastMaintenance) < time.Hour {
+		return nil
+	}
+	s.lastMaintenance = snap.Time
+	return s.Maintain(snap.Time)
+}
+
+func (s *Store) WriteLogEntries(batch *sinks.LogBatch) error {
+	return s.SaveLogEntries(batch.Modem, batch.New, batch.Time)
+}
+
+func (s *Store) WriteEvent(*events.Event) error { return nil }
@@ -0,0 +1,220 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DirectionDownstream = "downstream"
+	DirectionUpstream   = "upstream"
+)
+
+type Config struct {
+	Path string
+	// Raw snapshot and channel rows older than this are folded into hourly rollups.
+	RawRetention time.Duration
+	// Rollups and log entries older than these are deleted. Zero keeps them forever.
+	RollupRetention time.Duration
+	LogRetention    time.Duration
+}
+
+// A SQLite database holding every snapshot, its channels and the parsed modem log.
+type Store struct {
+	config Config
+	db     *sql.DB
+	mutex  sync.Mutex
+	// When WriteSnapshot last ran Maintain.
+	lastMaintenance time.Time
+}
+
+func Open(config Config) (*Store, error) {
+	db, err := sql.Open("sqlite", config.Path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite serializes writers anyway; a single connection avoids SQLITE_BUSY between them.
+	db.SetMaxOpenConns(1)
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA foreign_keys = ON", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", pragma, err)
+		}
+	}
+	s := &Store{config: config, db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", config.Path, err)
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save a snapshot and all of its channels in a single transaction. A snapshot already stored
+// for the same modem and second is replaced, so saving the same snapshot twice is harmless.
+func (s *Store) SaveSnapshot(snap *snapshot.Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agg := snap.Aggregates()
+	var healthScore sql.NullFloat64
+	if snap.Health != nil {
+		healthScore = sql.NullFloat64{Float64: snap.Health.Value, Valid: true}
+	}
+	conn := snap.Connection
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM channels WHERE snapshot_id IN (SELECT id FROM snapshots WHERE modem = ? AND time = ?)`,
+		snap.Modem, snap.Time.Unix())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM snapshots WHERE modem = ? AND time = ?`, snap.Modem, snap.Time.Unix()); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`INSERT INTO snapshots (time, modem, connectivity, boot_status, config_file_status,
+		uptime, health, locked_downstream, total_downstream, locked_upstream, total_upstream,
+		total_corrected, total_uncorrected, power_spread) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		snap.Time.Unix(), snap.Modem, conn.ConnectivityStatus, conn.BootStatus, conn.ConfigFileStatus,
+		int64(conn.UptimeDuration().Seconds()), healthScore, agg.LockedDownstream, agg.TotalDownstream,
+		agg.LockedUpstream, agg.TotalUpstream, agg.TotalCorrected, agg.TotalUncorrected, agg.PowerSpread)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	insert, err := tx.Prepare(`INSERT INTO channels (snapshot_id, time, modem, direction, channel, type,
+		lock_status, modulation, channel_id, frequency, power, snr, corrected, uncorrected, symbol_rate, verdict)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	var report thresholds.Report
+	if snap.Report != nil {
+		report = *snap.Report
+	}
+	for _, row := range channelRows(conn, &report) {
+		_, err := insert.Exec(id, snap.Time.Unix(), snap.Modem, row.direction, row.channel, row.channelType,
+			row.lockStatus, row.modulation, row.channelID, row.frequency, row.power, row.snr,
+			row.corrected, row.uncorrected, row.symbolRate, row.verdict)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Save parsed log entries. Entries already stored for the modem are ignored.
+func (s *Store) SaveLogEntries(modemName string, entries []modem.LogEntry, recorded time.Time) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert, err := tx.Prepare(`INSERT OR IGNORE INTO log_entries (time, recorded, modem, priority, message,
+		event_id, category, severity) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, entry := range entries {
+		// Entries logged before the modem learned the time of day have no usable timestamp.
+		var entryTime sql.NullInt64
+		if !entry.Time.IsZero() {
+			entryTime = sql.NullInt64{Int64: entry.Time.Unix(), Valid: true}
+		}
+		_, err := insert.Exec(entryTime, recorded.Unix(), modemName, entry.Priority, entry.Message,
+			entry.Event.ID, entry.Event.Category, entry.Event.Severity)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type channelRow struct {
+	direction   string
+	channel     int
+	channelType modem.ChannelType
+	lockStatus  string
+	modulation  string
+	channelID   int
+	frequency   float64
+	power       float64
+	snr         sql.NullFloat64
+	corrected   sql.NullInt64
+	uncorrected sql.NullInt64
+	symbolRate  sql.NullInt64
+	verdict     string
+}
+
+func channelRows(conn *modem.Connection, report *thresholds.Report) []channelRow {
+	var rows []channelRow
+	downstream := conn.DownstreamChannels()
+	for _, c := range downstream.SCQAM {
+		rows = append(rows, channelRow{
+			direction: DirectionDownstream, channel: c.Channel, channelType: modem.ChannelSCQAM,
+			lockStatus: c.LockStatus, modulation: c.Modulation, channelID: c.ChannelID,
+			frequency: c.Frequency, power: c.Power,
+			snr:         sql.NullFloat64{Float64: c.SNR, Valid: true},
+			corrected:   sql.NullInt64{Int64: c.Corrected, Valid: true},
+			uncorrected: sql.NullInt64{Int64: c.Uncorrected, Valid: true},
+			verdict:     string(report.DownstreamVerdict(c.Channel)),
+		})
+	}
+	for _, c := range downstream.OFDM {
+		// MER is stored in the snr column, the same way the modem reports it.
+		rows = append(rows, channelRow{
+			direction: DirectionDownstream, channel: c.Channel, channelType: modem.ChannelOFDM,
+			lockStatus: c.LockStatus, modulation: string(modem.ChannelOFDM), channelID: c.ChannelID,
+			frequency: c.PLCFrequency, power: c.Power,
+			snr:         sql.NullFloat64{Float64: c.MER, Valid: true},
+			corrected:   sql.NullInt64{Int64: c.Corrected, Valid: true},
+			uncorrected: sql.NullInt64{Int64: c.Uncorrected, Valid: true},
+			verdict:     string(report.DownstreamVerdict(c.Channel)),
+		})
+	}
+	upstream := conn.UpstreamChannels()
+	for _, c := range upstream.SCQAM {
+		rows = append(rows, channelRow{
+			direction: DirectionUpstream, channel: c.Channel, channelType: modem.ChannelSCQAM,
+			lockStatus: c.LockStatus, channelID: c.ChannelID, frequency: c.Frequency, power: c.Power,
+			symbolRate: sql.NullInt64{Int64: int64(c.SymbolRate), Valid: true},
+			verdict:    string(report.UpstreamVerdict(c.Channel)),
+		})
+	}
+	for _, c := range upstream.OFDMA {
+		rows = append(rows, channelRow{
+			direction: DirectionUpstream, channel: c.Channel, channelType: modem.ChannelOFDMA,
+			lockStatus: c.LockStatus, channelID: c.ChannelID, frequency: c.Frequency, power: c.Power,
+			verdict: string(report.UpstreamVerdict(c.Channel)),
+		})
+	}
+	return rows
+}
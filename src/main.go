@@ -1,20 +1,37 @@
 package main
 
 import (
-	// "encoding/json"
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"path"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/RickyGrassmuck/modem_logs/alerts"
+	"github.com/RickyGrassmuck/modem_logs/archive"
+	"github.com/RickyGrassmuck/modem_logs/breaker"
+	"github.com/RickyGrassmuck/modem_logs/events"
+	"github.com/RickyGrassmuck/modem_logs/health"
+	"github.com/RickyGrassmuck/modem_logs/history"
 	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
-	"github.com/RickyGrassmuck/modem_logs/utils"
-	"github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api/write"
-	"github.com/influxdata/influxdb-client-go/v2/domain"
+	"github.com/RickyGrassmuck/modem_logs/notify"
+	"github.com/RickyGrassmuck/modem_logs/outages"
+	"github.com/RickyGrassmuck/modem_logs/remediation"
+	"github.com/RickyGrassmuck/modem_logs/scheduler"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/sinks/influx"
+	"github.com/RickyGrassmuck/modem_logs/sinks/loki"
+	"github.com/RickyGrassmuck/modem_logs/sinks/mqtt"
+	"github.com/RickyGrassmuck/modem_logs/sinks/syslog"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+	"github.com/RickyGrassmuck/modem_logs/web"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/shopspring/decimal"
@@ -24,6 +41,17 @@ var logger *log.Logger
 var defaultLogDir string
 var defaultModemAddr string
 var defaultLogFileName string = "modem_logs.txt"
+var defaultModemName string = "mb8611"
+var defaultJournalFileName string = "modem_journal.jsonl"
+var defaultHistoryFileName string = "modem_history.db"
+var defaultSeenLogFileName string = "modem_log_seen.json"
+
+// The collections the collect command schedules.
+const (
+	jobDeviceInfo = "device_info"
+	jobLogs       = "logs"
+	jobStats      = "stats"
+)
 
 func init() {
 	defaultLogDir, _ = os.Getwd()
@@ -34,25 +62,51 @@ func init() {
 type Config struct {
 	DebugMode   bool
 	ModemConfig *modem.ModemConfig
+	ModemName   string
+	DeviceInfo  *modem.DeviceInfo
+	LastConn    *modem.Connection
+	LastPoll    time.Time
+	LogEntries  []modem.LogEntry
+	// Entries new since the previous poll was journaled.
+	NewEntries []modem.LogEntry
+	// The entries of the previous poll's log, oldest first.
+	seenEntries []string
+	// Where the entries of the latest log are remembered, so that a restart does not forward the
+	// whole log again. Only collect sets it.
+	SeenLogFile string
 	LogFile     string
 	ModemAddr   string
-	Influx      InfluxConfig
+	Remediation *remediation.Engine
+	Thresholds  *thresholds.Profile
+	Alerts      *alerts.Engine
+	Email       *EmailConfig
+	Journal     *outages.Journal
+	History     *history.Store
+	WebAddress  string
+	Web         *web.Server
+	Sinks       *sinks.Dispatcher
+	Scheduler   *scheduler.Scheduler
+	// Holds back collection while the modem does not answer. Nil outside collect.
+	Breaker *breaker.Breaker
+	// The clock the pipeline runs on; time.Now when nil. Replays substitute a virtual clock.
+	Now func() time.Time
+}
+
+func (c *Config) now() time.Time {
+	if c.Now != nil {
+		return c.Now().UTC()
+	}
+	return time.Now().UTC()
 }
 
-type InfluxConfig struct {
-	URL    string
-	Token  string
-	Bucket string
-	Org    string
-	Client influxdb2.Client
+func (c *Config) newEvent(eventType, message string) *events.Event {
+	return events.NewAt(c.now(), c.ModemName, eventType, message)
 }
-type InfluxDownstream struct {
-	Time              time.Time
-	Channel           decimal.Decimal
-	Power             decimal.Decimal
-	SNR               decimal.Decimal
-	CorrectedErrors   decimal.Decimal
-	UncorrectedErrors decimal.Decimal
+
+type EmailConfig struct {
+	Notifier       *notify.EmailNotifier
+	DigestInterval time.Duration
+	LastDigest     time.Time
 }
 
 func getEnvOrExit(varName string) string {
@@ -73,9 +127,63 @@ func getEnvOrDefault(varName string, defaultVal string) string {
 	return envVar
 }
 
+func getEnvDurationOrDefault(varName string, defaultVal time.Duration) time.Duration {
+	envVar, ok := os.LookupEnv(varName)
+	if !ok {
+		return defaultVal
+	}
+	value, err := time.ParseDuration(envVar)
+	if err != nil {
+		logger.Printf("Invalid duration for %s: %v\n", varName, err)
+		os.Exit(1)
+	}
+	return value
+}
+
+func getEnvIntOrDefault(varName string, defaultVal int) int {
+	envVar, ok := os.LookupEnv(varName)
+	if !ok {
+		return defaultVal
+	}
+	value, err := strconv.Atoi(envVar)
+	if err != nil {
+		logger.Printf("Invalid integer for %s: %v\n", varName, err)
+		os.Exit(1)
+	}
+	return value
+}
+
+func getEnvFloatOrDefault(varName string, defaultVal float64) float64 {
+	envVar, ok := os.LookupEnv(varName)
+	if !ok {
+		return defaultVal
+	}
+	value, err := strconv.ParseFloat(envVar, 64)
+	if err != nil {
+		logger.Printf("Invalid number for %s: %v\n", varName, err)
+		os.Exit(1)
+	}
+	return value
+}
+
+func flagWasSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func envIsSet(varName string) bool {
+	_, ok := os.LookupEnv(varName)
+	return ok
+}
+
 func setup() *Config {
 	var err error
-	conf := &Config{Influx: InfluxConfig{}}
+	conf := &Config{}
 	_, ok := os.LookupEnv("MODEM_DEBUG")
 	if !ok {
 		conf.DebugMode = false
@@ -86,11 +194,18 @@ func setup() *Config {
 	username := getEnvOrExit("MODEM_USERNAME")
 	password := getEnvOrExit("MODEM_PASSWORD")
 	conf.ModemAddr = getEnvOrDefault("MODEM_ADDRESS", defaultModemAddr)
+	conf.ModemName = getEnvOrDefault("MODEM_NAME", defaultModemName)
+	conf.Journal = newJournal()
+	conf.Thresholds, err = thresholds.Load(getEnvOrDefault("THRESHOLDS_PROFILE", "docsis"), os.Getenv("THRESHOLDS_FILE"))
+	if err != nil {
+		logger.Fatal(err)
+	}
 	conf.LogFile = getEnvOrDefault("MODEM_LOG_DESTINATION", defaultLogFileName)
 	conf.ModemConfig, err = modem.NewClient(conf.ModemAddr)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	conf.setupArchive()
 
 	auth, err := conf.ModemConfig.Login(username, password)
 	if err != nil {
@@ -102,68 +217,327 @@ func setup() *Config {
 		os.Exit(1)
 	}
 
-	influxURL := getEnvOrExit("INFLUX_URL")
-	influxToken := getEnvOrExit("INFLUX_TOKEN")
-	influxBucket := getEnvOrExit("INFLUX_BUCKET")
-	influxOrg := getEnvOrExit("INFLUX_ORG")
+	return conf
+}
+
+func (c *Config) setupRemediation() {
+	if !envIsSet("REMEDIATION_ENABLED") {
+		return
+	}
+	c.Remediation = remediation.NewEngine(remediationPolicy())
+}
 
-	conf.Influx = InfluxConfig{
-		URL:    influxURL,
-		Token:  influxToken,
-		Bucket: influxBucket,
-		Org:    influxOrg,
+func remediationPolicy() remediation.Policy {
+	return remediation.Policy{
+		DryRun:               envIsSet("REMEDIATION_DRY_RUN"),
+		NoLockSustain:        getEnvDurationOrDefault("REMEDIATION_NO_LOCK_FOR", 5*time.Minute),
+		UncorrectableRate:    getEnvFloatOrDefault("REMEDIATION_UNCORRECTABLE_RATE", 1000),
+		UncorrectableSustain: getEnvDurationOrDefault("REMEDIATION_UNCORRECTABLE_FOR", 30*time.Minute),
+		Cooldown:             getEnvDurationOrDefault("REMEDIATION_COOLDOWN", time.Hour),
+		MaxRebootsPerDay:     getEnvIntOrDefault("REMEDIATION_MAX_DAILY_REBOOTS", 3),
+		AuditLogPath:         getEnvOrDefault("REMEDIATION_AUDIT_LOG", "remediation_audit.log"),
 	}
-	client := influxdb2.NewClient(conf.Influx.URL, conf.Influx.Token)
+}
 
-	conf.Influx.Client = client
+// Reports alert transitions through the logger and as events.
+type eventNotifier struct {
+	conf *Config
+}
 
-	return conf
+func (n *eventNotifier) Notify(alert alerts.Alert) error {
+	eventType := events.AlertFiring
+	if alert.State == alerts.Resolved {
+		eventType = events.AlertResolved
+	}
+	event := n.conf.newEvent(eventType, fmt.Sprintf("%s (%s): %s", alert.Rule, alert.Severity, alert.Description)).
+		WithField("rule", alert.Rule).
+		WithField("severity", alert.Severity).
+		WithField("value", alert.Value)
+	n.conf.emitEvent(event)
+	return nil
 }
 
+func (c *Config) setupAlerts() {
+	if !envIsSet("ALERTS_ENABLED") {
+		return
+	}
+	rules := alerts.DefaultRules
+	if rulesFile, ok := os.LookupEnv("ALERT_RULES_FILE"); ok {
+		var err error
+		rules, err = alerts.LoadRules(rulesFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	engine, err := alerts.NewEngine(rules, getEnvOrDefault("ALERT_STATE_FILE", "alert_state.json"), &eventNotifier{conf: c})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	c.Alerts = engine
+}
+
+func (c *Config) setupEmail() {
+	host, ok := os.LookupEnv("SMTP_HOST")
+	if !ok {
+		return
+	}
+	var recipients []string
+	for _, to := range strings.Split(getEnvOrExit("SMTP_TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			recipients = append(recipients, to)
+		}
+	}
+	notifier, err := notify.NewEmailNotifier(notify.EmailConfig{
+		Host:               host,
+		Port:               getEnvIntOrDefault("SMTP_PORT", 587),
+		TLSMode:            getEnvOrDefault("SMTP_TLS", notify.TLSStartTLS),
+		InsecureSkipVerify: envIsSet("SMTP_TLS_INSECURE"),
+		Username:           os.Getenv("SMTP_USERNAME"),
+		Password:           os.Getenv("SMTP_PASSWORD"),
+		From:               getEnvOrExit("SMTP_FROM"),
+		To:                 recipients,
+		ModemName:          c.ModemName,
+		TextTemplatePath:   os.Getenv("SMTP_TEXT_TEMPLATE"),
+		HTMLTemplatePath:   os.Getenv("SMTP_HTML_TEMPLATE"),
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// Without alert rules there is nothing to notify about, but the digests still go out.
+	if c.Alerts != nil {
+		c.Alerts.AddNotifier(notifier)
+	}
+	c.Email = &EmailConfig{
+		Notifier:       notifier,
+		DigestInterval: getEnvDurationOrDefault("SMTP_DIGEST_INTERVAL", 0),
+		LastDigest:     c.now(),
+	}
+}
+
+// Hand the snapshot to the email notifier and send the periodic digest when it is due.
+func (c *Config) updateEmail(connDetails *modem.Connection, report *thresholds.Report, score *health.Score) {
+	if c.Email == nil {
+		return
+	}
+	c.Email.Notifier.SetSnapshot(connDetails, report, score)
+	if c.Email.DigestInterval <= 0 || c.now().Sub(c.Email.LastDigest) < c.Email.DigestInterval {
+		return
+	}
+	var active []alerts.Alert
+	if c.Alerts != nil {
+		active = c.Alerts.Active()
+	}
+	if err := c.Email.Notifier.SendDigest(active); err != nil {
+		logger.Printf("Sending digest email failed: %v\n", err)
+		return
+	}
+	c.Email.LastDigest = c.now()
+}
+
+func (c *Config) setupMQTT() sinks.Sink {
+	broker, ok := os.LookupEnv("MQTT_BROKER")
+	if !ok {
+		return nil
+	}
+	publisher, err := mqtt.New(mqtt.Config{
+		Broker:          broker,
+		ClientID:        getEnvOrDefault("MQTT_CLIENT_ID", "modem_stats_"+c.ModemName),
+		Username:        os.Getenv("MQTT_USERNAME"),
+		Password:        os.Getenv("MQTT_PASSWORD"),
+		TopicPrefix:     os.Getenv("MQTT_TOPIC_PREFIX"),
+		DiscoveryPrefix: getEnvOrDefault("MQTT_DISCOVERY_PREFIX", "homeassistant"),
+		Retain:          envIsSet("MQTT_RETAIN"),
+		QoS:             byte(getEnvIntOrDefault("MQTT_QOS", 0)),
+		ModemName:       c.ModemName,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return publisher
+}
+
+func (c *Config) setupSyslog() sinks.Sink {
+	address, ok := os.LookupEnv("SYSLOG_ADDRESS")
+	if !ok {
+		return nil
+	}
+	forwarder, err := syslog.New(syslog.Config{
+		Address:            address,
+		Transport:          getEnvOrDefault("SYSLOG_TRANSPORT", syslog.TransportUDP),
+		Facility:           getEnvIntOrDefault("SYSLOG_FACILITY", 16),
+		InsecureSkipVerify: envIsSet("SYSLOG_TLS_INSECURE"),
+		ModemName:          c.ModemName,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return forwarder
+}
+
+func (c *Config) setupLoki() sinks.Sink {
+	url, ok := os.LookupEnv("LOKI_URL")
+	if !ok {
+		return nil
+	}
+	return loki.New(loki.Config{
+		URL:           url,
+		TenantID:      os.Getenv("LOKI_TENANT_ID"),
+		Username:      os.Getenv("LOKI_USERNAME"),
+		Password:      os.Getenv("LOKI_PASSWORD"),
+		BatchSize:     getEnvIntOrDefault("LOKI_BATCH_SIZE", 100),
+		BatchInterval: getEnvDurationOrDefault("LOKI_BATCH_INTERVAL", 5*time.Second),
+		MaxRetries:    getEnvIntOrDefault("LOKI_MAX_RETRIES", 5),
+		ModemName:     c.ModemName,
+	})
+}
+
+// The outage journal, trimmed to OUTAGE_JOURNAL_RETENTION as polls are recorded.
+func newJournal() *outages.Journal {
+	return outages.NewJournal(getEnvOrDefault("MODEM_JOURNAL", defaultJournalFileName), getEnvDurationOrDefault("OUTAGE_JOURNAL_RETENTION", 90*24*time.Hour))
+}
+
+// Archive every raw status response when ARCHIVE_DIR is set.
+func (c *Config) setupArchive() {
+	dir, ok := os.LookupEnv("ARCHIVE_DIR")
+	if !ok {
+		return
+	}
+	recorder, err := archive.New(archive.Config{
+		Dir:       dir,
+		Modem:     c.ModemName,
+		Retention: getEnvDurationOrDefault("ARCHIVE_RETENTION", 30*24*time.Hour),
+		MaxBytes:  int64(getEnvIntOrDefault("ARCHIVE_MAX_BYTES", 0)),
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	c.ModemConfig.Recorder = recorder
+}
+
+func (c *Config) setupHistory() sinks.Sink {
+	path, ok := os.LookupEnv("HISTORY_DB")
+	if !ok {
+		return nil
+	}
+	store, err := history.Open(history.Config{
+		Path:            path,
+		RawRetention:    getEnvDurationOrDefault("HISTORY_RAW_RETENTION", 7*24*time.Hour),
+		RollupRetention: getEnvDurationOrDefault("HISTORY_ROLLUP_RETENTION", 365*24*time.Hour),
+		LogRetention:    getEnvDurationOrDefault("HISTORY_LOG_RETENTION", 90*24*time.Hour),
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	c.History = store
+	return store
+}
+
+// Create the dashboard server. It starts listening in startSinks, once there are sink
+// counters to serve.
+func (c *Config) setupWeb() sinks.Sink {
+	if c.WebAddress == "" {
+		c.WebAddress = os.Getenv("SERVE_ADDRESS")
+	}
+	if c.WebAddress == "" {
+		return nil
+	}
+	config := web.Config{
+		Address:     c.WebAddress,
+		ModemName:   c.ModemName,
+		Token:       os.Getenv("SERVE_TOKEN"),
+		TLSCertFile: os.Getenv("SERVE_TLS_CERT"),
+		TLSKeyFile:  os.Getenv("SERVE_TLS_KEY"),
+		ReadyMaxAge: getEnvDurationOrDefault("SERVE_READY_MAX_AGE", 2*time.Minute),
+		Journal:     c.Journal,
+		MaxGap:      getEnvDurationOrDefault("OUTAGE_MAX_GAP", time.Minute),
+		History:     c.History,
+		SinkStats:   c.sinkStats,
+	}
+	if c.Scheduler != nil {
+		config.Schedule = c.Scheduler.Stats
+		config.Collect = c.collectNow
+	}
+	if c.Breaker != nil {
+		config.Breaker = c.Breaker.Status
+	}
+	c.Web = web.New(config)
+	return c.Web
+}
+
+func (c *Config) setupInflux() sinks.Sink {
+	influxURL, ok := os.LookupEnv("INFLUX_URL")
+	if !ok {
+		return nil
+	}
+	config := influx.Config{
+		URL:           influxURL,
+		Token:         getEnvOrExit("INFLUX_TOKEN"),
+		Bucket:        getEnvOrExit("INFLUX_BUCKET"),
+		Org:           getEnvOrExit("INFLUX_ORG"),
+		Stats:         c.sinkStats,
+		StatsInterval: getEnvDurationOrDefault("INFLUX_SINK_STATS_INTERVAL", time.Minute),
+	}
+	if c.Breaker != nil {
+		config.Breaker = c.Breaker.Status
+	}
+	return influx.New(config)
+}
+
+// Append the lines of data that were not in the previous write to the file, and keep data in
+// <filepath>.last to compare the next write with.
 func appendFile(filepath string, data string) error {
 	lastWriteFilePath := fmt.Sprintf("%s.%s", filepath, "last")
-	tmpFilePath := fmt.Sprintf("%s.%s", filepath, "tmp")
-	tmpFile, _ := os.OpenFile(tmpFilePath, os.O_RDWR|os.O_CREATE, 0644)
-	defer tmpFile.Close()
-	_, _ = tmpFile.WriteString(data)
-
-	// Last write file exists, check if current data is different from last write file
-	if _, err := os.Stat(lastWriteFilePath); err == nil {
-		sameAsLast, _ := utils.DeepCompare(lastWriteFilePath, tmpFilePath)
-		if sameAsLast {
-			logger.Println("No new log messages, skipping...")
-			os.Remove(tmpFilePath)
-			return nil
+	previous := map[string]bool{}
+	if last, err := os.ReadFile(lastWriteFilePath); err == nil {
+		for _, line := range strings.Split(string(last), "\n") {
+			previous[line] = true
 		}
 	} else {
 		logger.Println("No last write file found, creating...")
-		lastWriteFile, err := os.OpenFile(lastWriteFilePath, os.O_RDWR|os.O_CREATE, 0644)
-		if err != nil {
-			return err
+	}
+	var fresh strings.Builder
+	for _, line := range strings.Split(data, "\n") {
+		if line != "" && !previous[line] {
+			fresh.WriteString(line + "\n")
 		}
-		defer lastWriteFile.Close()
-		lastWriteFile.WriteString(data)
 	}
-	aggregateLogFile, _ := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if fresh.Len() == 0 {
+		logger.Println("No new log messages, skipping...")
+		return nil
+	}
+	aggregateLogFile, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
 	defer aggregateLogFile.Close()
-	_, err := aggregateLogFile.WriteString(data)
-	os.Remove(tmpFilePath)
-	return err
+	if _, err := aggregateLogFile.WriteString(fresh.String()); err != nil {
+		return err
+	}
+	return os.WriteFile(lastWriteFilePath, []byte(data), 0644)
+}
+
+var verdictColors = map[thresholds.Verdict]text.Colors{
+	thresholds.Good:     {text.FgGreen},
+	thresholds.Marginal: {text.FgYellow},
+	thresholds.Bad:      {text.FgRed},
 }
 
-func generateTable(title string, headers table.Row, records [][]string, output io.Writer) table.Writer {
+func generateTable(title string, headers table.Row, records [][]string, verdicts map[int]thresholds.ChannelVerdict, output io.Writer) table.Writer {
 	newTable := table.NewWriter()
 	newTable.SetTitle("%s", title)
 	newTable.SetStyle(table.StyleLight)
 	newTable.Style().Title.Align = text.AlignCenter
 	newTable.SetOutputMirror(os.Stdout)
-	newTable.AppendHeader(headers)
+	newTable.AppendHeader(append(append(table.Row{}, headers...), "Verdict"))
 	var rows []table.Row
 	for _, v := range records[1:] {
 		row := table.Row{}
 		for _, r := range v {
 			row = append(row, r)
 		}
+		channel, _ := strconv.Atoi(strings.TrimSpace(v[0]))
+		verdict := verdicts[channel].Verdict
+		row = append(row, verdictColors[verdict].Sprint(verdict))
 		rows = append(rows, row)
 
 	}
@@ -172,121 +546,569 @@ func generateTable(title string, headers table.Row, records [][]string, output i
 	return newTable
 }
 
-func (c *Config) saveLogs() {
-	logs, err := c.ModemConfig.GetLogs()
+// Append the modem log entries that are new since the last write to the log file.
+func (c *Config) saveLogs(logs *modem.Logs) {
+	if err := appendFile(c.LogFile, logs.LogMessages()); err != nil {
+		logger.Printf("Saving the modem log to %s failed: %v\n", c.LogFile, err)
+	}
+}
+
+func printDeviceInfo(info *modem.DeviceInfo) {
+	infoTable := table.NewWriter()
+	infoTable.SetTitle("DEVICE")
+	infoTable.SetStyle(table.StyleLight)
+	infoTable.Style().Title.Align = text.AlignCenter
+	infoTable.SetOutputMirror(os.Stdout)
+	infoTable.AppendRows([]table.Row{
+		{"Software Version", info.SoftwareVersion},
+		{"Hardware Version", info.HardwareVersion},
+		{"Serial Number", info.SerialNumber},
+		{"Cable MAC", info.CableMAC},
+		{"Boot File", info.BootFile},
+		{"DOCSIS Version", info.DOCSISVersion},
+	})
+	infoTable.Render()
+}
+
+func printConnectionDetails(connDetails *modem.Connection, report *thresholds.Report) {
+	statusTable := table.NewWriter()
+	statusTable.SetTitle("CONNECTION")
+	statusTable.SetStyle(table.StyleLight)
+	statusTable.Style().Title.Align = text.AlignCenter
+	statusTable.SetOutputMirror(os.Stdout)
+	statusTable.AppendRows([]table.Row{
+		{"Connectivity", connDetails.ConnectivityStatus},
+		{"Uptime", connDetails.Uptime},
+		{"Downstream Frequency", connDetails.DownstreamFrequency},
+		{"Link Aggregation", connDetails.LagStatus},
+	})
+	statusTable.Render()
+
+	dsTable := generateTable("DOWNSTREAM", modem.DownstreamHeaders, connDetails.Downstream.ToCSV(), report.Downstream, os.Stdout)
+	usTable := generateTable("UPSTREAM", modem.UpstreamHeaders, connDetails.Upstream.ToCSV(), report.Upstream, os.Stdout)
+	dsTable.Render()
+	usTable.Render()
+}
+
+// Fetch the device identity and emit an event when the firmware version differs from the previous poll.
+func (c *Config) refreshDeviceInfo() {
+	info, err := c.ModemConfig.GetDeviceInfo()
+	c.reportModem(err)
 	if err != nil {
 		logger.Printf("%v\n", err)
-		os.Exit(1)
+		return
+	}
+	c.updateDeviceInfo(info)
+}
+
+func (c *Config) updateDeviceInfo(info *modem.DeviceInfo) {
+	// A modem that answers the action with an error leaves every field empty. That says nothing
+	// about the firmware, so the identity from the last good answer is kept.
+	if info.SoftwareVersion == "" && c.DeviceInfo != nil {
+		return
+	}
+	if c.DeviceInfo != nil && c.DeviceInfo.SoftwareVersion != info.SoftwareVersion {
+		event := c.newEvent(events.FirmwareChanged,
+			fmt.Sprintf("firmware changed from %s to %s", c.DeviceInfo.SoftwareVersion, info.SoftwareVersion)).
+			WithField("previous", c.DeviceInfo.SoftwareVersion).
+			WithField("current", info.SoftwareVersion)
+		c.emitEvent(event)
+	}
+	c.DeviceInfo = info
+}
+
+func (c *Config) emitEvent(e *events.Event) {
+	logger.Printf("Event: %s\n", e)
+	c.Sinks.PublishEvent(e)
+}
+
+// Compare the new snapshot with the previous poll and emit events for state transitions.
+func (c *Config) trackConnectionChanges(connDetails *modem.Connection) {
+	if connDetails == nil {
+		return
+	}
+	if c.LastConn != nil {
+		previous, current := c.LastConn.UptimeDuration(), connDetails.UptimeDuration()
+		if current > 0 && current < previous {
+			event := c.newEvent(events.ModemRebooted,
+				fmt.Sprintf("uptime went back from %s to %s", c.LastConn.Uptime, connDetails.Uptime)).
+				WithField("previous_uptime", c.LastConn.Uptime).
+				WithField("current_uptime", connDetails.Uptime)
+			c.emitEvent(event)
+		}
 	}
-	err = appendFile(path.Join(c.LogFile, defaultLogFileName), logs.LogMessages())
+	if c.LastConn != nil && c.LastConn.LagStatus != connDetails.LagStatus {
+		event := c.newEvent(events.LagChanged,
+			fmt.Sprintf("link aggregation changed from %q to %q", c.LastConn.LagStatus, connDetails.LagStatus)).
+			WithField("previous", c.LastConn.LagStatus).
+			WithField("current", connDetails.LagStatus)
+		c.emitEvent(event)
+	}
+	c.LastConn = connDetails
+	c.LastPoll = c.now()
+}
+
+// Fetch the modem log and run it through processLogs. Returns nil when the request failed.
+func (c *Config) refreshLogEntries() *modem.Logs {
+	logs, err := c.ModemConfig.GetLogs()
+	c.reportModem(err)
 	if err != nil {
 		logger.Printf("%v\n", err)
-		os.Exit(1)
+		return nil
 	}
+	c.processLogs(logs.Entries(), c.now())
+	return logs
 }
 
-func printConnectionDetails(connDetails *modem.Connection) {
+// Take the log fetched at now as the current log and publish the entries that are new to the
+// sinks. The new entries are also kept for the journal until the next poll records them.
+// Returns the new entries.
+func (c *Config) processLogs(entries []modem.LogEntry, now time.Time) []modem.LogEntry {
+	c.LogEntries = entries
+	fresh := c.newLogEntries(entries)
+	c.NewEntries = append(c.NewEntries, fresh...)
+	c.Sinks.PublishLogEntries(&sinks.LogBatch{
+		Modem:      c.ModemName,
+		DeviceInfo: c.DeviceInfo,
+		Time:       now,
+		New:        fresh,
+		All:        entries,
+	})
+	return fresh
+}
 
-	dsTable := generateTable("DOWNSTREAM", modem.DownstreamHeaders, connDetails.Downstream.ToCSV(), os.Stdout)
-	usTable := generateTable("UPSTREAM", modem.UpstreamHeaders, connDetails.Upstream.ToCSV(), os.Stdout)
-	dsTable.Render()
-	usTable.Render()
+func (c *Config) collectLogs() {
+	if logs := c.refreshLogEntries(); logs != nil {
+		c.saveLogs(logs)
+	}
 }
 
-func downstreamStatsToInflux(connDetails modem.ConnectionDetails) []*write.Point {
+// Return the entries that were not in the previous poll's log. Everything is new on the first
+// poll, unless SeenLogFile has the log from before a restart.
+//
+// The modem drops its oldest entries and appends new ones, so the new entries are those after
+// the longest run at the start of the log that the previous log ended with. Going by position
+// rather than by content keeps repeats new, such as the same T3 time-out logged before the
+// modem knew the time of day after two reboots.
+func (c *Config) newLogEntries(entries []modem.LogEntry) []modem.LogEntry {
+	if c.seenEntries == nil && c.SeenLogFile != "" {
+		c.seenEntries = loadSeenEntries(c.SeenLogFile)
+	}
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = fmt.Sprintf("%s|%d|%s", entry.Time.Format(time.RFC3339), entry.Priority, entry.Message)
+	}
+	overlap := logOverlap(c.seenEntries, keys)
+	fresh := entries[overlap:]
+	changed := overlap != len(c.seenEntries) || overlap != len(keys)
+	c.seenEntries = keys
+	if changed && c.SeenLogFile != "" {
+		if err := saveSeenEntries(c.SeenLogFile, keys); err != nil {
+			logger.Printf("Saving seen log entries failed: %v\n", err)
+		}
+	}
+	return fresh
+}
 
-	var points []*write.Point
+// The length of the longest prefix of current that previous ends with.
+func logOverlap(previous, current []string) int {
+	n := len(previous)
+	if len(current) < n {
+		n = len(current)
+	}
+	for ; n > 0; n-- {
+		match := true
+		for i := 0; i < n && match; i++ {
+			match = current[i] == previous[len(previous)-n+i]
+		}
+		if match {
+			return n
+		}
+	}
+	return 0
+}
 
-	records := connDetails.ToCSV()
-	influxTimeStamp := time.Now().UTC()
+// The log remembered in path. It is never nil, so that it is only read once.
+func loadSeenEntries(path string) []string {
+	var keys []string
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Printf("Reading seen log entries failed: %v\n", err)
+	} else if err == nil {
+		if err := json.Unmarshal(data, &keys); err != nil {
+			logger.Printf("Parsing %s failed: %v\n", path, err)
+		}
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys
+}
 
-	powerLevels := []float64{}
-	totalCorrected := decimal.NewFromInt(0)
-	totalUncorrected := decimal.NewFromInt(0)
+func saveSeenEntries(path string, keys []string) error {
+	data, _ := json.MarshalIndent(keys, "", "  ")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
 
-	for _, record := range records {
-		channel := record[0]
-		power, _ := decimal.NewFromString(record[5])
-		snr, _ := decimal.NewFromString(record[6])
-		correctedErrors, _ := decimal.NewFromString(record[7])
-		uncorrectedErrors, _ := decimal.NewFromString(record[8])
+func printLogEntries(entries []modem.LogEntry, limit int) {
+	logTable := table.NewWriter()
+	logTable.SetTitle("RECENT EVENTS")
+	logTable.SetStyle(table.StyleLight)
+	logTable.Style().Title.Align = text.AlignCenter
+	logTable.SetOutputMirror(os.Stdout)
+	logTable.AppendHeader(table.Row{"Time", "Event", "Category", "Severity", "Message", "Hint"})
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	for _, entry := range entries {
+		timestamp := "-"
+		if !entry.Time.IsZero() {
+			timestamp = entry.Time.Format("2006-01-02 15:04:05")
+		}
+		message, _ := entry.Attributes()
+		logTable.AppendRow(table.Row{timestamp, entry.Event.ID, entry.Event.Category, entry.Event.Severity,
+			text.WrapSoft(message, 50), text.WrapSoft(entry.Event.Hint, 50)})
+	}
+	logTable.Render()
+}
 
-		p := influxdb2.NewPointWithMeasurement("downstream").
-			AddTag("id", channel).
-			AddField("power", power).
-			AddField("snr", snr).
-			AddField("corrected_errors", correctedErrors).
-			AddField("uncorrected_errors", uncorrectedErrors).
-			SetTime(influxTimeStamp)
+// Score the snapshot. The uncorrectable rate is taken against the previous poll, so this has to
+// run before trackConnectionChanges replaces it.
+func (c *Config) healthScore(connDetails *modem.Connection, report *thresholds.Report, now time.Time) *health.Score {
+	return health.Compute(health.Input{
+		Connection:           connDetails,
+		Report:               report,
+		UncorrectedPerMinute: c.uncorrectedRate(connDetails, now),
+		LogEntries:           c.LogEntries,
+		Now:                  now,
+	})
+}
 
-		totalCorrected = totalCorrected.Add(correctedErrors)
-		totalUncorrected = totalUncorrected.Add(uncorrectedErrors)
-		powerLevels = append(powerLevels, power.InexactFloat64())
-		points = append(points, p)
+// Uncorrectable codewords per minute since the previous poll. Counter resets read as zero.
+func (c *Config) uncorrectedRate(connDetails *modem.Connection, now time.Time) float64 {
+	if c.LastConn == nil || !now.After(c.LastPoll) {
+		return 0
 	}
+	delta := totalUncorrected(connDetails.Downstream) - totalUncorrected(c.LastConn.Downstream)
+	if delta <= 0 {
+		return 0
+	}
+	return delta / now.Sub(c.LastPoll).Minutes()
+}
 
-	sumPoint := influxdb2.NewPointWithMeasurement("downstream").
-		AddTag("id", "101").
-		AddField("power", decimal.NewFromFloat(0.0)).
-		AddField("snr", decimal.NewFromFloat(0.0)).
-		AddField("corrected_errors", totalCorrected).
-		AddField("uncorrected_errors", totalUncorrected).
-		SetTime(influxTimeStamp)
+// Evaluate the alert rules against the snapshot. Like healthScore, this must run before
+// trackConnectionChanges so that rates are taken against the previous poll.
+func (c *Config) evaluateAlerts(connDetails *modem.Connection, report *thresholds.Report, score *health.Score) {
+	if c.Alerts == nil {
+		return
+	}
+	now := c.now()
+	verdicts := map[thresholds.Verdict]float64{}
+	for _, v := range report.Downstream {
+		verdicts[v.Verdict]++
+	}
+	for _, v := range report.Upstream {
+		verdicts[v.Verdict]++
+	}
+	sample := alerts.Sample{
+		Time: now,
+		Values: map[string]float64{
+			"health_score":           score.Value,
+			"locked_downstream":      float64(connDetails.Downstream.LockedCount()),
+			"total_downstream":       float64(len(connDetails.Downstream.ToCSV())),
+			"locked_upstream":        float64(connDetails.Upstream.LockedCount()),
+			"total_upstream":         float64(len(connDetails.Upstream.ToCSV())),
+			"uncorrected_total":      totalUncorrected(connDetails.Downstream),
+			"uncorrected_per_minute": c.uncorrectedRate(connDetails, now),
+			"uptime_seconds":         connDetails.UptimeDuration().Seconds(),
+			"bad_channels":           verdicts[thresholds.Bad],
+			"marginal_channels":      verdicts[thresholds.Marginal],
+		},
+		Strings: map[string]string{
+			"connectivity": connDetails.ConnectivityStatus,
+			"lag_status":   connDetails.LagStatus,
+		},
+		LogEntries: c.LogEntries,
+	}
+	c.Alerts.Evaluate(sample)
+}
 
-	logger.Printf("Total Corrected: %v\n", totalCorrected)
-	logger.Printf("Total Uncorrected: %v\n", totalUncorrected)
-	points = append(points, sumPoint)
+func printHealth(score *health.Score) {
+	healthTable := table.NewWriter()
+	healthTable.SetTitle("HEALTH: %.1f / 100", score.Value)
+	healthTable.SetStyle(table.StyleLight)
+	healthTable.Style().Title.Align = text.AlignCenter
+	healthTable.SetOutputMirror(os.Stdout)
+	healthTable.AppendHeader(table.Row{"Factor", "Penalty", "Detail"})
+	for _, f := range score.Factors {
+		healthTable.AppendRow(table.Row{f.Name, fmt.Sprintf("-%.1f", f.Penalty), f.Detail})
+	}
+	healthTable.Render()
+}
 
-	powerSpreadPoint := influxdb2.NewPointWithMeasurement("downstream").
-		AddTag("id", "102").
-		AddField("power", decimal.NewFromFloat(utils.CalculateSpread(powerLevels)).Round(1)).
-		AddField("snr", decimal.NewFromFloat(0.0)).
-		AddField("corrected_errors", decimal.NewFromFloat(0.0)).
-		AddField("uncorrected_errors", decimal.NewFromFloat(0.0)).
-		SetTime(influxTimeStamp)
+func totalUncorrected(details modem.ConnectionDetails) float64 {
+	total := decimal.NewFromInt(0)
+	for _, record := range details.ToCSV() {
+		if len(record) < 9 {
+			continue
+		}
+		uncorrected, _ := decimal.NewFromString(record[8])
+		total = total.Add(uncorrected)
+	}
+	return total.InexactFloat64()
+}
 
-	points = append(points, powerSpreadPoint)
+// Feed the snapshot to the remediation engine and reboot the modem when the policy asks for it.
+func (c *Config) remediate(connDetails *modem.Connection) {
+	if c.Remediation == nil || connDetails == nil {
+		return
+	}
+	decision := c.Remediation.Evaluate(remediation.Observation{
+		Time:             c.now(),
+		LockedDownstream: connDetails.Downstream.LockedCount(),
+		Uncorrected:      totalUncorrected(connDetails.Downstream),
+	})
+	switch decision.Action {
+	case remediation.ActionReboot:
+		logger.Printf("Remediation: rebooting modem (%s)\n", decision.Reason)
+		_, err := c.rebootAndTrack(10*time.Minute, 5*time.Second)
+		c.Remediation.RecordOutcome(decision, err)
+		if err != nil {
+			logger.Printf("%v\n", err)
+		}
+		// The reboot cleared the log and may have brought new firmware.
+		if c.Scheduler != nil {
+			c.Scheduler.RunNow(jobDeviceInfo)
+			c.Scheduler.RunNow(jobLogs)
+		}
+	case remediation.ActionDryRun:
+		logger.Printf("Remediation (dry run): would reboot modem (%s)\n", decision.Reason)
+	case remediation.ActionSuppressed:
+		logger.Printf("Remediation: reboot suppressed (%s)\n", decision.Reason)
+	}
+}
 
-	return points
+// Record the poll outcome and the log entries that are new since the previous poll in the
+// journal used for outage analysis. A nil connDetails records a failed poll.
+func (c *Config) recordObservation(connDetails *modem.Connection) {
+	entries := c.NewEntries
+	c.NewEntries = nil
+	if c.Journal == nil {
+		return
+	}
+	obs := outages.Observation{Time: c.now()}
+	if connDetails != nil {
+		obs.Reachable = true
+		obs.Connectivity = connDetails.ConnectivityStatus
+		obs.LockedDownstream = connDetails.Downstream.LockedCount()
+		obs.TotalDownstream = len(connDetails.Downstream.ToCSV())
+		obs.Uptime = connDetails.UptimeDuration()
+	}
+	if err := c.Journal.Record(obs, entries); err != nil {
+		logger.Printf("Writing journal failed: %v\n", err)
+	}
 }
 
-func (c *Config) writeConnectionStatsInfluxdb(stats *modem.Connection) error {
-	ctx := context.Background()
-	bucketsAPI := c.Influx.Client.BucketsAPI()
-	_, err := bucketsAPI.FindBucketByName(ctx, "modem_stats")
+func runStatus(conf *Config) {
+	conf.refreshDeviceInfo()
+	if conf.DeviceInfo != nil {
+		printDeviceInfo(conf.DeviceInfo)
+	}
+	connDetails, err := conf.ModemConfig.GetConnectionDetails()
 	if err != nil {
-		logger.Printf("Bucket not found, creating...\n")
-		org, err := c.Influx.Client.OrganizationsAPI().FindOrganizationByName(ctx, c.Influx.Org)
-		if err != nil {
-			panic(err)
+		logger.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	conf.refreshLogEntries()
+	report := conf.Thresholds.Evaluate(connDetails)
+	printConnectionDetails(connDetails, report)
+	printHealth(conf.healthScore(connDetails, report, time.Now().UTC()))
+	printLogEntries(conf.LogEntries, 10)
+}
+
+// Run a successful poll through the pipeline: the outage journal, thresholds and health, the
+// sinks, alerts and change tracking. Health and alerts go by the log from the latest processLogs.
+func (c *Config) processPoll(connDetails *modem.Connection, now time.Time) *snapshot.Snapshot {
+	c.recordObservation(connDetails)
+	report := c.Thresholds.Evaluate(connDetails)
+	score := c.healthScore(connDetails, report, now)
+	snap := &snapshot.Snapshot{
+		Time:       now,
+		Modem:      c.ModemName,
+		Connection: connDetails,
+		DeviceInfo: c.DeviceInfo,
+		Report:     report,
+		Health:     score,
+	}
+	c.Sinks.PublishSnapshot(snap)
+	c.updateEmail(connDetails, report, score)
+	c.evaluateAlerts(connDetails, report, score)
+	c.trackConnectionChanges(connDetails)
+	return snap
+}
+
+// Poll the connection details and run them through the pipeline.
+func (c *Config) collectStats() {
+	connDetails, err := c.ModemConfig.GetConnectionDetails()
+	c.reportModem(err)
+	if err != nil {
+		logger.Printf("%v\n", err)
+		c.recordObservation(nil)
+		return
+	}
+	snap := c.processPoll(connDetails, c.now())
+	aggregates := snap.Aggregates()
+	logger.Printf("Health score: %.1f\n", snap.Health.Value)
+	logger.Printf("Total Corrected: %d\n", aggregates.TotalCorrected)
+	logger.Printf("Total Uncorrected: %d\n", aggregates.TotalUncorrected)
+	c.remediate(connDetails)
+}
+
+func (c *Config) setupScheduler() {
+	jitter := getEnvDurationOrDefault("COLLECT_JITTER", 0)
+	// The log comes before the stats, so that the first poll is scored with it.
+	s, err := scheduler.New(
+		scheduler.Job{Name: jobDeviceInfo, Interval: getEnvDurationOrDefault("DEVICE_INFO_INTERVAL", time.Hour),
+			Jitter: jitter, Run: c.guarded(jobDeviceInfo, c.refreshDeviceInfo)},
+		scheduler.Job{Name: jobLogs, Interval: getEnvDurationOrDefault("LOG_INTERVAL", 5*time.Minute),
+			Jitter: jitter, Run: c.guarded(jobLogs, c.collectLogs)},
+		scheduler.Job{Name: jobStats, Interval: getEnvDurationOrDefault("STATS_INTERVAL", 10*time.Second),
+			Jitter: jitter, Run: c.guarded(jobStats, c.collectStats)},
+	)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	s.Logf = logger.Printf
+	c.Scheduler = s
+}
+
+// Back off from the modem when it stops answering, and once it has failed BREAKER_THRESHOLD
+// times in a row, take it to be unreachable until a probe gets an answer again.
+func (c *Config) setupBreaker() {
+	c.Breaker = breaker.New(breaker.Config{
+		Threshold: getEnvIntOrDefault("BREAKER_THRESHOLD", 3),
+		BaseDelay: getEnvDurationOrDefault("BACKOFF_BASE", 10*time.Second),
+		MaxDelay:  getEnvDurationOrDefault("BACKOFF_MAX", 5*time.Minute),
+		OnChange:  c.reachabilityChanged,
+	})
+}
+
+// Wrap a collection job so that it only runs when the breaker lets requests to the modem
+// through. Nothing reaches the sinks while it holds them back, but a held back stats run is
+// journaled as a failed poll, so that outage analysis sees the modem as down.
+func (c *Config) guarded(job string, run func()) func() {
+	return func() {
+		if c.Breaker == nil {
+			run()
+			return
 		}
-		_, err = bucketsAPI.CreateBucketWithName(ctx, org, c.Influx.Bucket, domain.RetentionRule{EverySeconds: 0})
-		if err != nil {
-			panic(err)
+		if !c.Breaker.Allow(c.now()) {
+			if job == jobStats {
+				c.recordObservation(nil)
+			}
+			return
+		}
+		run()
+		if status := c.Breaker.Status(); status.Failures > 1 || status.State != breaker.Closed {
+			logger.Printf("Modem requests failed %d times in a row, next attempt in %s\n",
+				status.Failures, time.Until(status.RetryAt).Round(time.Second))
 		}
-		logger.Printf("Bucket Created")
 	}
-	writeAPI := c.Influx.Client.WriteAPI(c.Influx.Org, c.Influx.Bucket)
-	dsPoints := downstreamStatsToInflux(stats.Downstream)
-	for _, p := range dsPoints {
-		writeAPI.WritePoint(p)
+}
+
+// Tell the breaker whether the modem answered a request. A response that does not parse still
+// came from the modem.
+func (c *Config) reportModem(err error) {
+	if c.Breaker == nil {
+		return
+	}
+	var parseErr *modem.ParseError
+	if err == nil || errors.As(err, &parseErr) {
+		c.Breaker.Success()
+		return
 	}
-	writeAPI.Flush()
-	return nil
+	c.Breaker.Failure(err)
 }
 
-func main() {
-	conf := setup()
-	defer conf.Influx.Client.Close()
+func (c *Config) reachabilityChanged(from, to breaker.State, status breaker.Status) {
+	switch to {
+	case breaker.Open:
+		c.emitEvent(c.newEvent(events.ModemUnreachable,
+			fmt.Sprintf("no answer to %d requests in a row: %s", status.Failures, status.LastError)).
+			WithField("failures", strconv.Itoa(status.Failures)).
+			WithField("last_error", status.LastError))
+	case breaker.Closed:
+		down := c.now().Sub(status.Since).Round(time.Second)
+		c.emitEvent(c.newEvent(events.ModemReachable,
+			fmt.Sprintf("answering again after %s", down)).
+			WithField("failures", strconv.Itoa(status.Failures)).
+			WithField("duration", down.String()))
+		// The modem most likely restarted, which clears the log and may bring new firmware.
+		if c.Scheduler != nil {
+			c.Scheduler.RunNow(jobDeviceInfo)
+			c.Scheduler.RunNow(jobLogs)
+		}
+	}
+}
 
-	for {
-		connDetails, err := conf.ModemConfig.GetConnectionDetails()
-		if err != nil {
-			logger.Printf("%v\n", err)
+// Run a collection job as soon as possible, or every job when job is empty.
+func (c *Config) collectNow(job string) error {
+	if job != "" {
+		return c.Scheduler.RunNow(job)
+	}
+	for _, name := range c.Scheduler.Names() {
+		if err := c.Scheduler.RunNow(name); err != nil {
+			return err
 		}
-		conf.writeConnectionStatsInfluxdb(connDetails)
-		fmt.Printf("Sleeping for 10 seconds...\n\n")
-		time.Sleep(10 * time.Second)
 	}
+	return nil
+}
 
+func runCollect(conf *Config) {
+	// The dashboard triggers collections, so the scheduler has to exist before it starts.
+	conf.SeenLogFile = getEnvOrDefault("MODEM_LOG_SEEN", defaultSeenLogFileName)
+	conf.setupBreaker()
+	conf.setupScheduler()
+	// Sinks come first so that events raised while setting up the rest reach them.
+	conf.setupConfiguredSinks()
+	defer conf.Sinks.Close()
+	conf.setupRemediation()
+	conf.setupAlerts()
+	conf.setupEmail()
+	conf.Scheduler.Run(context.Background())
+}
+
+func main() {
+	command := "collect"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "collect":
+		runCollect(setup())
+	case "status":
+		runStatus(setup())
+	case "reboot":
+		runReboot(os.Args[2:])
+	case "outages":
+		runOutages(os.Args[2:])
+	case "history":
+		runHistory(os.Args[2:])
+	case "serve":
+		runServe(setup(), os.Args[2:])
+	case "reprocess":
+		runReprocess(os.Args[2:])
+	case "simulate":
+		runSimulate(os.Args[2:])
+	case "replay":
+		runReplay(os.Args[2:])
+	default:
+		logger.Printf("Unknown command: %s\n", command)
+		os.Exit(1)
+	}
 }
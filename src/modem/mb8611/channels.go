@@ -0,0 +1,160 @@
+package mb8611
+
+import (
+	"strconv"
+	"strings"
+)
+
+type ChannelType string
+
+const (
+	ChannelSCQAM ChannelType = "SC-QAM"
+	ChannelOFDM  ChannelType = "OFDM"
+	ChannelOFDMA ChannelType = "OFDMA"
+)
+
+// A single-carrier QAM downstream channel.
+type DownstreamChannel struct {
+	Channel     int
+	LockStatus  string
+	Modulation  string
+	ChannelID   int
+	Frequency   float64
+	Power       float64
+	SNR         float64
+	Corrected   int64
+	Uncorrected int64
+}
+
+// A DOCSIS 3.1 OFDM downstream channel. The modem reports it as a single row keyed on the
+// PLC (PHY link channel) frequency and reports MER in the column used for SNR on SC-QAM rows.
+type OFDMChannel struct {
+	Channel      int
+	LockStatus   string
+	ChannelID    int
+	PLCFrequency float64
+	Power        float64
+	MER          float64
+	Corrected    int64
+	Uncorrected  int64
+}
+
+// A single-carrier QAM upstream channel.
+type UpstreamChannel struct {
+	Channel    int
+	LockStatus string
+	ChannelID  int
+	SymbolRate int
+	Frequency  float64
+	Power      float64
+}
+
+// A DOCSIS 3.1 OFDMA upstream channel. The modem reports no symbol rate for these.
+type OFDMAChannel struct {
+	Channel    int
+	LockStatus string
+	ChannelID  int
+	Frequency  float64
+	Power      float64
+}
+
+type DownstreamChannels struct {
+	SCQAM []DownstreamChannel
+	OFDM  []OFDMChannel
+}
+
+type UpstreamChannels struct {
+	SCQAM []UpstreamChannel
+	OFDMA []OFDMAChannel
+}
+
+func DownstreamChannelType(modulation string) ChannelType {
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(modulation)), "OFDM") {
+		return ChannelOFDM
+	}
+	return ChannelSCQAM
+}
+
+func UpstreamChannelType(channelType string) ChannelType {
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(channelType)), "OFDMA") {
+		return ChannelOFDMA
+	}
+	return ChannelSCQAM
+}
+
+func (c *Connection) DownstreamChannels() DownstreamChannels {
+	var channels DownstreamChannels
+	for _, record := range c.Downstream.ToCSV() {
+		if len(record) < 9 {
+			continue
+		}
+		if DownstreamChannelType(record[2]) == ChannelOFDM {
+			channels.OFDM = append(channels.OFDM, OFDMChannel{
+				Channel:      parseInt(record[0]),
+				LockStatus:   strings.TrimSpace(record[1]),
+				ChannelID:    parseInt(record[3]),
+				PLCFrequency: parseFloat(record[4]),
+				Power:        parseFloat(record[5]),
+				MER:          parseFloat(record[6]),
+				Corrected:    parseInt64(record[7]),
+				Uncorrected:  parseInt64(record[8]),
+			})
+			continue
+		}
+		channels.SCQAM = append(channels.SCQAM, DownstreamChannel{
+			Channel:     parseInt(record[0]),
+			LockStatus:  strings.TrimSpace(record[1]),
+			Modulation:  strings.TrimSpace(record[2]),
+			ChannelID:   parseInt(record[3]),
+			Frequency:   parseFloat(record[4]),
+			Power:       parseFloat(record[5]),
+			SNR:         parseFloat(record[6]),
+			Corrected:   parseInt64(record[7]),
+			Uncorrected: parseInt64(record[8]),
+		})
+	}
+	return channels
+}
+
+func (c *Connection) UpstreamChannels() UpstreamChannels {
+	var channels UpstreamChannels
+	for _, record := range c.Upstream.ToCSV() {
+		if len(record) < 7 {
+			continue
+		}
+		if UpstreamChannelType(record[2]) == ChannelOFDMA {
+			channels.OFDMA = append(channels.OFDMA, OFDMAChannel{
+				Channel:    parseInt(record[0]),
+				LockStatus: strings.TrimSpace(record[1]),
+				ChannelID:  parseInt(record[3]),
+				Frequency:  parseFloat(record[5]),
+				Power:      parseFloat(record[6]),
+			})
+			continue
+		}
+		channels.SCQAM = append(channels.SCQAM, UpstreamChannel{
+			Channel:    parseInt(record[0]),
+			LockStatus: strings.TrimSpace(record[1]),
+			ChannelID:  parseInt(record[3]),
+			SymbolRate: parseInt(record[4]),
+			Frequency:  parseFloat(record[5]),
+			Power:      parseFloat(record[6]),
+		})
+	}
+	return channels
+}
+
+func parseInt(s string) int {
+	value, _ := strconv.Atoi(strings.TrimSpace(s))
+	return value
+}
+
+func parseInt64(s string) int64 {
+	value, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return value
+}
+
+func parseFloat(s string) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return value
+}
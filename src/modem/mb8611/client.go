@@ -4,14 +4,56 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
+	"time"
 )
 
+// Names under which status responses are handed to a Recorder.
+const (
+	ActionConnection = "connection"
+	ActionLogs       = "logs"
+	ActionDeviceInfo = "device_info"
+)
+
+// Receives the raw body of every status response (connection info, logs and device info)
+// before it is parsed. Login and reboot responses are never recorded.
+type Recorder interface {
+	Record(action string, body []byte, at time.Time)
+}
+
+// How long a request may take before it is given up, unless the caller sets its own timeout on
+// ModemConfig.Client.
+const DefaultTimeout = 30 * time.Second
+
+// Returned when the modem rejects a status request because the session is gone, e.g. after it
+// restarted, and logging in again did not help.
+var ErrUnauthorized = errors.New("modem rejected the session")
+
+// Returned when the modem answered with a body that does not parse. The modem is up, so this
+// is no reason to back off from it.
+type ParseError struct {
+	Response string
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parsing %s response: %v", e.Response, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 type ModemConfig struct {
 	Endpoint string
 	Client   *http.Client
+	Recorder Recorder
+	username string
+	password string
 }
 
 type APIRequest interface {
@@ -25,7 +67,8 @@ func NewClient(address string) (*ModemConfig, error) {
 		return nil, err
 	}
 	client := http.Client{
-		Jar: jar,
+		Jar:     jar,
+		Timeout: DefaultTimeout,
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		},
@@ -38,31 +81,134 @@ func NewClient(address string) (*ModemConfig, error) {
 }
 
 func (c *ModemConfig) Login(username, password string) (*LoginRequest, error) {
+	c.username = username
+	c.password = password
 	loginRequest := NewLoginRequest(username, password)
 	_, body, err := c.Post(loginRequest)
 	_ = json.Unmarshal(body, loginRequest)
 	return loginRequest, err
 }
 
+// Log in again with the credentials from the last call to Login, e.g. after the modem restarted.
+func (c *ModemConfig) Reauthenticate() error {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	c.Client.Jar = jar
+	auth, err := c.Login(c.username, c.password)
+	if err != nil {
+		return err
+	}
+	if auth.LoginResponse.LoginResult != "OK" {
+		return fmt.Errorf("login failed: %s", auth.LoginResponse.LoginResult)
+	}
+	return nil
+}
+
+func (c *ModemConfig) Reboot() error {
+	reboot := NewRebootRequest()
+	_, body, err := c.Post(reboot)
+	if err != nil {
+		return err
+	}
+	_ = json.Unmarshal(body, reboot)
+	if reboot.Response.Result != "OK" {
+		return fmt.Errorf("reboot request failed: %q", reboot.Response.Result)
+	}
+	return nil
+}
+
 func (c *ModemConfig) GetLogs() (*Logs, error) {
-	logs := NewLogs()
-	_, body, err := c.Post(logs)
+	body, err := c.postStatus(ActionLogs, NewLogs())
 	if err != nil {
 		return nil, err
 	}
-	_ = json.Unmarshal(body, &logs.Response)
-	return logs, err
+	return ParseLogs(body)
 }
 
 func (c *ModemConfig) GetConnectionDetails() (*Connection, error) {
-	conn := NewConnectionDetails()
-	_, body, err := c.Post(conn)
+	body, err := c.postStatus(ActionConnection, NewConnectionDetails())
+	if err != nil {
+		return nil, err
+	}
+	return ParseConnectionDetails(body)
+}
+
+func (c *ModemConfig) GetDeviceInfo() (*DeviceInfo, error) {
+	body, err := c.postStatus(ActionDeviceInfo, NewDeviceInfo())
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeviceInfo(body)
+}
+
+// Post a status request and record the response. When the modem has dropped the session, log
+// in again once and repeat the request.
+func (c *ModemConfig) postStatus(action string, r APIRequest) ([]byte, error) {
+	_, body, err := c.Post(r)
 	if err != nil {
 		return nil, err
 	}
-	_ = json.Unmarshal(body, &conn)
-	details := conn.SanitizedDetails()
-	return details, err
+	if unauthorized(body) {
+		if err := c.Reauthenticate(); err != nil {
+			return nil, fmt.Errorf("%w: logging in again: %v", ErrUnauthorized, err)
+		}
+		if _, body, err = c.Post(r); err != nil {
+			return nil, err
+		}
+		if unauthorized(body) {
+			return nil, ErrUnauthorized
+		}
+	}
+	c.record(action, body)
+	return body, nil
+}
+
+// Whether the modem answered a status request with UN-AUTH.
+func unauthorized(body []byte) bool {
+	var response struct {
+		GetMultipleHNAPsResponse struct {
+			GetMultipleHNAPsResult string `json:"GetMultipleHNAPsResult"`
+		} `json:"GetMultipleHNAPsResponse"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return false
+	}
+	return response.GetMultipleHNAPsResponse.GetMultipleHNAPsResult == "UN-AUTH"
+}
+
+// Parse the body of a log response, as returned by GetLogs.
+func ParseLogs(body []byte) (*Logs, error) {
+	logs := NewLogs()
+	if err := json.Unmarshal(body, &logs.Response); err != nil {
+		return nil, &ParseError{Response: "log", Err: err}
+	}
+	return logs, nil
+}
+
+// Parse the body of a connection info response, as returned by GetConnectionDetails.
+func ParseConnectionDetails(body []byte) (*Connection, error) {
+	conn := NewConnectionDetails()
+	if err := json.Unmarshal(body, &conn); err != nil {
+		return nil, &ParseError{Response: "connection", Err: err}
+	}
+	return conn.SanitizedDetails(), nil
+}
+
+// Parse the body of a device info response, as returned by GetDeviceInfo.
+func ParseDeviceInfo(body []byte) (*DeviceInfo, error) {
+	info := NewDeviceInfo()
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, &ParseError{Response: "device info", Err: err}
+	}
+	return info.SanitizedInfo(), nil
+}
+
+func (c *ModemConfig) record(action string, body []byte) {
+	if c.Recorder != nil {
+		c.Recorder.Record(action, body, time.Now().UTC())
+	}
 }
 
 // Make an HTTP Post request to the endpoint and return the response.
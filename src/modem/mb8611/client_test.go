@@ -0,0 +1,183 @@
+package mb8611_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/modem/mb8611/simulator"
+)
+
+// A clock the test moves by hand, so that reboots take no real time.
+type clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestClient(t *testing.T) (*modem.ModemConfig, *simulator.TestServer, *clock) {
+	t.Helper()
+	now := &clock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)}
+	config := simulator.DefaultConfig()
+	config.Now = now.Now
+	config.UnlockedUpstream = []int{2}
+	server := simulator.NewTestServer(config)
+	t.Cleanup(server.Close)
+
+	client, err := modem.NewClient(server.Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.Timeout = 5 * time.Second
+	auth, err := client.Login(config.Username, config.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := auth.LoginResponse.LoginResult; result != "OK" {
+		t.Fatalf("login result = %q, want OK", result)
+	}
+	return client, server, now
+}
+
+func TestLoginRejected(t *testing.T) {
+	server := simulator.NewTestServer(simulator.DefaultConfig())
+	defer server.Close()
+	client, err := modem.NewClient(server.Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := client.Login("admin", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := auth.LoginResponse.LoginResult; result != "FAILED" {
+		t.Errorf("login result = %q, want FAILED", result)
+	}
+	if _, err := client.GetConnectionDetails(); !errors.Is(err, modem.ErrUnauthorized) {
+		t.Errorf("polling without a session: err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	client, server, _ := newTestClient(t)
+
+	conn, err := client.GetConnectionDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conn.StartupComplete() {
+		t.Errorf("startup incomplete: connectivity %q, boot %q", conn.ConnectivityStatus, conn.BootStatus)
+	}
+	config := server.Simulator.Config()
+	if n := len(conn.Downstream.ToCSV()); n != config.Downstream+config.OFDM {
+		t.Errorf("got %d downstream channels, want %d", n, config.Downstream+config.OFDM)
+	}
+	if !conn.Downstream.AllLocked() {
+		t.Error("downstream channels not all locked")
+	}
+	if locked, want := conn.Upstream.LockedCount(), config.Upstream+config.OFDMA-1; locked != want {
+		t.Errorf("%d upstream channels locked, want %d", locked, want)
+	}
+
+	server.Simulator.AddLogEntry(3, "SYNC Timing Synchronization failure - Loss of Sync")
+	logs, err := client.GetLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := logs.Entries()
+	if len(entries) == 0 || !strings.HasPrefix(entries[len(entries)-1].Message, "SYNC Timing Synchronization failure") {
+		t.Errorf("log entries %v do not end with the added entry", entries)
+	}
+
+	info, err := client.GetDeviceInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SoftwareVersion == "" || info.SerialNumber == "" {
+		t.Errorf("device info lacks the software version or serial number: %+v", info)
+	}
+}
+
+func TestSessionDropped(t *testing.T) {
+	client, server, _ := newTestClient(t)
+
+	// The client logs in again and repeats the request without the caller noticing.
+	server.Simulator.Inject(simulator.FailureAuth, 1)
+	if _, err := client.GetConnectionDetails(); err != nil {
+		t.Fatalf("after a dropped session: %v", err)
+	}
+}
+
+func TestMalformedResponse(t *testing.T) {
+	client, server, _ := newTestClient(t)
+
+	server.Simulator.Inject(simulator.FailureMalformed, 1)
+	_, err := client.GetConnectionDetails()
+	var parseErr *modem.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("err = %v, want a ParseError", err)
+	}
+	if _, err := client.GetConnectionDetails(); err != nil {
+		t.Errorf("after a malformed response: %v", err)
+	}
+}
+
+func TestReboot(t *testing.T) {
+	client, server, now := newTestClient(t)
+	config := server.Simulator.Config()
+
+	if err := client.Reboot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetConnectionDetails(); err == nil {
+		t.Fatal("the modem answered while rebooting")
+	}
+
+	// Back up, but still locking its channels. The reboot dropped the session.
+	now.Advance(config.RebootDowntime)
+	conn, err := client.GetConnectionDetails()
+	if err != nil {
+		t.Fatalf("after the downtime: %v", err)
+	}
+	if conn.StartupComplete() {
+		t.Error("startup complete while the channels are still locking")
+	}
+
+	now.Advance(config.LockDelay)
+	conn, err = client.GetConnectionDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conn.StartupComplete() || !conn.Downstream.AllLocked() {
+		t.Error("startup incomplete once the lock delay has passed")
+	}
+	if uptime := conn.UptimeDuration(); uptime <= 0 || uptime > config.RebootDowntime+config.LockDelay {
+		t.Errorf("uptime %v, want the time since the reboot", uptime)
+	}
+
+	logs, err := client.GetLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebooted := false
+	for _, entry := range logs.Entries() {
+		rebooted = rebooted || strings.HasPrefix(entry.Message, "Cable Modem Reboot because of - HNAP reboot")
+	}
+	if !rebooted {
+		t.Error("the modem log does not record the reboot")
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	// "fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 )
@@ -83,8 +86,11 @@ type ConnectionDetails struct {
 
 type Connection struct {
 	ConnectivityStatus  string
+	BootStatus          string
+	ConfigFileStatus    string
 	Uptime              string
 	DownstreamFrequency string
+	LagStatus           string
 	Upstream            ConnectionDetails
 	Downstream          ConnectionDetails
 }
@@ -103,8 +109,11 @@ func NewConnectionDetails() *ConnectionData {
 func (c *ConnectionData) SanitizedDetails() *Connection {
 	details := Connection{
 		ConnectivityStatus:  c.Response.StartupSequence.ConnectivityStatus,
+		BootStatus:          c.Response.StartupSequence.BootStatus,
+		ConfigFileStatus:    c.Response.StartupSequence.ConfigurationFileStatus,
 		Uptime:              c.Response.ConnectionInfo.SystemUpTime,
 		DownstreamFrequency: c.Response.StartupSequence.DSFreq,
+		LagStatus:           c.Response.GetMotoLagStatusResponse.MotoLagCurrentStatus,
 	}
 	details.Upstream.Raw = c.Response.UpstreamChannelInfoResponse.UpstreamChannel
 	details.Downstream.Raw = c.Response.DownstreamChannelInfoResponse.DownstreamChannel
@@ -129,6 +138,53 @@ func (c *ConnectionData) SanitizedDetails() *Connection {
 	return &details
 }
 
+var uptimePattern = regexp.MustCompile(`(\d+)\s*days?\s+(\d+)h:(\d+)m:(\d+)s`)
+
+// Parse the uptime string, e.g. "2 days 05h:12m:33s". Returns zero when the format is not recognized.
+func (c *Connection) UptimeDuration() time.Duration {
+	match := uptimePattern.FindStringSubmatch(c.Uptime)
+	if match == nil {
+		return 0
+	}
+	var parts [4]int
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(match[i+1])
+	}
+	return time.Duration(parts[0])*24*time.Hour +
+		time.Duration(parts[1])*time.Hour +
+		time.Duration(parts[2])*time.Minute +
+		time.Duration(parts[3])*time.Second
+}
+
+// Reports whether the modem finished its boot, provisioning and connectivity steps.
+func (c *Connection) StartupComplete() bool {
+	return c.BootStatus == "OK" && c.ConfigFileStatus == "OK" && c.ConnectivityStatus == "OK"
+}
+
+// Reports whether at least one channel is listed and every channel reports "Locked".
+func (d *ConnectionDetails) AllLocked() bool {
+	records := d.ToCSV()
+	if len(records) == 0 {
+		return false
+	}
+	for _, record := range records {
+		if len(record) < 2 || strings.TrimSpace(record[1]) != "Locked" {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *ConnectionDetails) LockedCount() int {
+	locked := 0
+	for _, record := range d.ToCSV() {
+		if len(record) > 1 && strings.TrimSpace(record[1]) == "Locked" {
+			locked++
+		}
+	}
+	return locked
+}
+
 func (d *ConnectionDetails) ToInflux() {
 
 }
@@ -0,0 +1,91 @@
+package mb8611
+
+import (
+	"encoding/json"
+)
+
+type DeviceInfoData struct {
+	SOAPAction string
+	Request    struct {
+		GetMultipleHNAPs struct {
+			Software        string `json:"GetMotoStatusSoftware"`
+			StartupSequence string `json:"GetMotoStatusStartupSequence"`
+		} `json:"GetMultipleHNAPs"`
+	} `json:"-"`
+	Response struct {
+		Software struct {
+			SpecVersion         string `json:"StatusSoftwareSpecVer"`
+			HardwareVersion     string `json:"StatusSoftwareHdVer"`
+			SoftwareVersion     string `json:"StatusSoftwareSfVer"`
+			CustomerVersion     string `json:"StatusSoftwareCustomerVer"`
+			SerialNumber        string `json:"StatusSoftwareSerialNum"`
+			CableMAC            string `json:"StatusSoftwareMac"`
+			Certificate         string `json:"StatusSoftwareCertificate"`
+			GetMotoStatusResult string `json:"GetMotoStatusSoftwareResult"`
+		} `json:"GetMotoStatusSoftwareResponse"`
+		StartupSequence struct {
+			ConfigurationFileStatus  string `json:"MotoConnConfigurationFileStatus"`
+			ConfigurationFileComment string `json:"MotoConnConfigurationFileComment"`
+			Result                   string `json:"GetMotoStatusStartupSequenceResult"`
+		} `json:"GetMotoStatusStartupSequenceResponse"`
+		GetMultipleHNAPsResult string `json:"GetMultipleHNAPsResult"`
+	} `json:"GetMultipleHNAPsResponse"`
+}
+
+type DeviceInfo struct {
+	SoftwareVersion string
+	HardwareVersion string
+	SerialNumber    string
+	CableMAC        string
+	BootFile        string
+	DOCSISVersion   string
+}
+
+func NewDeviceInfo() *DeviceInfoData {
+	var info DeviceInfoData = DeviceInfoData{}
+	info.SOAPAction = "http://purenetworks.com/HNAP1/GetMultipleHNAPs"
+	info.Request.GetMultipleHNAPs.Software = ""
+	info.Request.GetMultipleHNAPs.StartupSequence = ""
+	return &info
+}
+
+func (d *DeviceInfoData) SanitizedInfo() *DeviceInfo {
+	return &DeviceInfo{
+		SoftwareVersion: d.Response.Software.SoftwareVersion,
+		HardwareVersion: d.Response.Software.HardwareVersion,
+		SerialNumber:    d.Response.Software.SerialNumber,
+		CableMAC:        d.Response.Software.CableMAC,
+		BootFile:        d.Response.StartupSequence.ConfigurationFileComment,
+		DOCSISVersion:   d.Response.Software.SpecVersion,
+	}
+}
+
+// Tags returns the device identity as key/value pairs suitable for tagging metrics.
+func (i *DeviceInfo) Tags() map[string]string {
+	return map[string]string{
+		"sw_version": i.SoftwareVersion,
+		"hw_version": i.HardwareVersion,
+		"serial":     i.SerialNumber,
+		"cable_mac":  i.CableMAC,
+		"docsis":     i.DOCSISVersion,
+	}
+}
+
+func (d *DeviceInfoData) Action() string {
+	return d.SOAPAction
+}
+
+func (d *DeviceInfoData) Marshal() []byte {
+	ret, _ := json.Marshal(d)
+	return ret
+}
+
+func (d *DeviceInfoData) MarshalRequest() []byte {
+	ret, _ := json.Marshal(d.Request)
+	return ret
+}
+
+func (d *DeviceInfoData) MarshalIndent() []byte {
+	ret, _ := json.MarshalIndent(d, "", "  ")
+	return ret
+}
@@ -2,9 +2,24 @@ package mb8611
 
 import (
 	"encoding/json"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/docsis"
 )
 
+const logTimeLayout = "Mon Jan 02 2006 15:04:05"
+
+// A single entry of the modem event log. Time is zero when the modem had not yet
+// established the time of day ("Time Not Established") when the entry was logged.
+type LogEntry struct {
+	Time     time.Time
+	Priority int
+	Message  string
+	Event    docsis.Classification
+}
+
 type Logs struct {
 	SOAPAction string
 	Request    struct {
@@ -58,6 +73,43 @@ func (l *Logs) LogMessages() string {
 	return ret
 }
 
+// Split the message into its text and the trailing "KEY=value;" attributes the modem appends,
+// e.g. "No Ranging Response received - T3 time-out;CM-MAC=aa:bb:..;CMTS-MAC=..;CM-QOS=1.1;CM-VER=3.1;".
+func (e LogEntry) Attributes() (string, map[string]string) {
+	attrs := map[string]string{}
+	parts := strings.Split(e.Message, ";")
+	text := strings.TrimSpace(parts[0])
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		attrs[key] = value
+	}
+	return text, attrs
+}
+
+// Parse the log list into entries. Entries are separated by "}-{" and hold the time,
+// date, priority and message separated by "^".
+func (l *Logs) Entries() []LogEntry {
+	var entries []LogEntry
+	for _, raw := range strings.Split(l.RawLogMessages(), "}-{") {
+		fields := strings.SplitN(raw, "^", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		entry := LogEntry{Message: strings.TrimSpace(fields[3])}
+		entry.Priority, _ = strconv.Atoi(strings.TrimSpace(fields[2]))
+		entry.Event = docsis.Classify(entry.Message, entry.Priority)
+		stamp := strings.TrimSpace(fields[1]) + " " + strings.TrimSpace(fields[0])
+		if t, err := time.ParseInLocation(logTimeLayout, stamp, time.Local); err == nil {
+			entry.Time = t
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
 func (l *Logs) Action() string {
 	return l.SOAPAction
 }
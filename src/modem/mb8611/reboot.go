@@ -0,0 +1,45 @@
+package mb8611
+
+import (
+	"encoding/json"
+)
+
+type RebootRequest struct {
+	SOAPAction string `json:"-"`
+	Request    struct {
+		SetStatusSecuritySettings struct {
+			SecurityAction string `json:"MotoStatusSecurityAction"`
+			SecXXX         string `json:"MotoStatusSecXXX"`
+		} `json:"SetStatusSecuritySettings"`
+	} `json:"-"`
+	Response struct {
+		Result string `json:"SetStatusSecuritySettingsResult"`
+	} `json:"SetStatusSecuritySettingsResponse"`
+}
+
+func NewRebootRequest() *RebootRequest {
+	var req RebootRequest = RebootRequest{}
+	req.SOAPAction = "http://purenetworks.com/HNAP1/SetStatusSecuritySettings"
+	req.Request.SetStatusSecuritySettings.SecurityAction = "1"
+	req.Request.SetStatusSecuritySettings.SecXXX = "XXX"
+	return &req
+}
+
+func (r *RebootRequest) Action() string {
+	return r.SOAPAction
+}
+
+func (r *RebootRequest) Marshal() []byte {
+	ret, _ := json.Marshal(r)
+	return ret
+}
+
+func (r *RebootRequest) MarshalRequest() []byte {
+	ret, _ := json.Marshal(r.Request)
+	return ret
+}
+
+func (r *RebootRequest) MarshalIndent() []byte {
+	ret, _ := json.MarshalIndent(r, "", "  ")
+	return ret
+}
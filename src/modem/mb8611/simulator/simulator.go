@@ -0,0 +1,629 @@
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A way to make the next status request fail.
+type Failure string
+
+const (
+	// The login is rejected and the session dropped, so status requests answer UN-AUTH.
+	FailureAuth Failure = "auth"
+	// The request hangs for Config.Timeout, then the connection is dropped.
+	FailureTimeout Failure = "timeout"
+	// The response body is cut off halfway through.
+	FailureMalformed Failure = "malformed"
+)
+
+var Failures = []Failure{FailureAuth, FailureTimeout, FailureMalformed}
+
+const (
+	logTimeLayout = "15:04:05"
+	logDateLayout = "Mon Jan 02 2006"
+	// Logged in place of the time and date until the modem has learned the time of day.
+	timeNotEstablished = "Time Not Established"
+	// The modem keeps a bounded log and drops the oldest entries.
+	maxLogEntries = 100
+	sessionCookie = "uid"
+	logSuffix     = ";CM-MAC=00:40:36:aa:bb:cc;CMTS-MAC=00:01:5c:11:22:33;CM-QOS=1.1;CM-VER=3.1;"
+)
+
+// Messages added at random when Config.LogEventsPerHour is set.
+var noiseMessages = []struct {
+	priority int
+	message  string
+}{
+	{3, "No Ranging Response received - T3 time-out"},
+	{3, "Started Unicast Maintenance Ranging - No Response received - T3 time-out"},
+	{3, "SYNC Timing Synchronization failure - Loss of Sync"},
+	{5, "Lost MDD Timeout"},
+	{6, "DHCP RENEW WARNING - Field invalid in response v4 option"},
+}
+
+type Config struct {
+	Username string
+	Password string
+	// Channel counts. Downstream and Upstream are SC-QAM channels.
+	Downstream int
+	OFDM       int
+	Upstream   int
+	OFDMA      int
+	// Levels the channels are spread around. Every poll adds Gaussian noise with a standard
+	// deviation of Noise.
+	DownstreamPower float64
+	DownstreamSNR   float64
+	UpstreamPower   float64
+	Noise           float64
+	// Codeword error counters grow by about this much per channel and minute of lock.
+	CorrectedPerMinute   float64
+	UncorrectedPerMinute float64
+	// Channel numbers listed here report "Not Locked".
+	UnlockedDownstream []int
+	UnlockedUpstream   []int
+	// Uptime reported at start.
+	Uptime time.Duration
+	// The modem is unreachable for RebootDowntime after a reboot, then reports its startup in
+	// progress and its channels unlocked for LockDelay. RebootEvery reboots it on its own;
+	// zero disables.
+	RebootEvery    time.Duration
+	RebootDowntime time.Duration
+	LockDelay      time.Duration
+	// Fraction of status requests that fail the given way.
+	AuthErrorRate float64
+	TimeoutRate   float64
+	MalformedRate float64
+	// How long a timed out request hangs before its connection is dropped.
+	Timeout time.Duration
+	// Ranging, sync and DHCP noise added to the modem log per hour.
+	LogEventsPerHour float64
+	// Seeds the values and failures, so that runs are repeatable.
+	Seed int64
+	// The clock; time.Now when nil.
+	Now func() time.Time `json:"-"`
+}
+
+// Settings of a healthy, fully locked modem.
+func DefaultConfig() Config {
+	return Config{
+		Username:             "admin",
+		Password:             "password",
+		Downstream:           32,
+		OFDM:                 1,
+		Upstream:             4,
+		OFDMA:                1,
+		DownstreamPower:      2.5,
+		DownstreamSNR:        40,
+		UpstreamPower:        44,
+		Noise:                0.2,
+		CorrectedPerMinute:   5,
+		UncorrectedPerMinute: 0.1,
+		Uptime:               72 * time.Hour,
+		RebootDowntime:       30 * time.Second,
+		LockDelay:            30 * time.Second,
+		Timeout:              time.Minute,
+		Seed:                 1,
+	}
+}
+
+type logEntry struct {
+	time     time.Time
+	priority int
+	message  string
+}
+
+// Answers HNAP requests the way an MB8611 does: the login, the status actions the client
+// polls (startup sequence, connection info, channels, lag status, software and log) and the
+// reboot request. Requests under /simulator/ control it; see ServeHTTP.
+type Simulator struct {
+	mutex    sync.Mutex
+	config   Config
+	random   *mathrand.Rand
+	sessions map[string]bool
+	// Uptime counts from bootedAt. The modem answers from bootedAt+RebootDowntime and locks
+	// its channels LockDelay later.
+	bootedAt     time.Time
+	answersAt    time.Time
+	lockedAt     time.Time
+	log          []logEntry
+	lastLogCheck time.Time
+	// Log entries still due from the current boot.
+	pendingRanging bool
+	pendingLock    bool
+	injected       []Failure
+	handler        http.Handler
+}
+
+func New(config Config) *Simulator {
+	s := &Simulator{config: config, random: mathrand.New(mathrand.NewSource(config.Seed)), sessions: map[string]bool{}}
+	now := s.now()
+	s.bootedAt = now.Add(-config.Uptime)
+	s.answersAt = s.bootedAt
+	s.lockedAt = s.bootedAt
+	s.lastLogCheck = now
+	s.appendLog(s.bootedAt, 6, "Honoring MDD; IP provisioning mode = IPv6")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/HNAP1/", s.handleHNAP)
+	mux.HandleFunc("/simulator/reboot", s.handleReboot)
+	mux.HandleFunc("/simulator/fail", s.handleFail)
+	mux.HandleFunc("/simulator/config", s.handleConfig)
+	mux.HandleFunc("/simulator/log", s.handleLog)
+	s.handler = mux
+	return s
+}
+
+// ServeHTTP serves the HNAP endpoint at /HNAP1/ and these control requests:
+//
+//	POST /simulator/reboot                          reboot now
+//	POST /simulator/fail?type=timeout&count=3       fail the next status requests
+//	GET  /simulator/config, PUT /simulator/config   read or replace the Config as JSON
+//	POST /simulator/log?priority=3&message=...      add a modem log entry
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s *Simulator) Config() Config {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.config
+}
+
+// Replace the configuration, e.g. to degrade the signal mid-run. The clock is kept.
+func (s *Simulator) SetConfig(config Config) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	config.Now = s.config.Now
+	s.config = config
+}
+
+// Reboot the modem as if it was asked to through HNAP.
+func (s *Simulator) Reboot() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reboot(s.now(), "HNAP reboot")
+}
+
+// Make the next count status requests fail.
+func (s *Simulator) Inject(failure Failure, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := 0; i < count; i++ {
+		s.injected = append(s.injected, failure)
+	}
+}
+
+// Add an entry to the modem log.
+func (s *Simulator) AddLogEntry(priority int, message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.appendLog(s.now(), priority, message)
+}
+
+func (s *Simulator) now() time.Time {
+	if s.config.Now != nil {
+		return s.config.Now()
+	}
+	return time.Now()
+}
+
+func (s *Simulator) reboot(now time.Time, reason string) {
+	s.appendLog(now, 3, "Cable Modem Reboot because of - "+reason)
+	s.bootedAt = now
+	s.answersAt = now.Add(s.config.RebootDowntime)
+	s.lockedAt = s.answersAt.Add(s.config.LockDelay)
+	s.sessions = map[string]bool{}
+	s.pendingRanging, s.pendingLock = true, true
+}
+
+func (s *Simulator) appendLog(at time.Time, priority int, message string) {
+	s.log = append(s.log, logEntry{time: at, priority: priority, message: message})
+	if len(s.log) > maxLogEntries {
+		s.log = s.log[len(s.log)-maxLogEntries:]
+	}
+}
+
+// Bring the modem up to date with the clock: scheduled reboots and log noise.
+func (s *Simulator) advance(now time.Time) {
+	if s.config.RebootEvery > 0 && now.Sub(s.bootedAt) >= s.config.RebootEvery {
+		s.reboot(now, "scheduled reboot")
+	}
+	if s.pendingRanging && !now.Before(s.answersAt) {
+		// Logged while ranging, before the modem has learned the time of day.
+		s.appendLog(time.Time{}, 3, "No Ranging Response received - T3 time-out"+logSuffix)
+		s.pendingRanging = false
+	}
+	if s.pendingLock && !now.Before(s.lockedAt) {
+		s.appendLog(s.lockedAt, 6, "Honoring MDD; IP provisioning mode = IPv6")
+		s.pendingLock = false
+	}
+	if s.config.LogEventsPerHour > 0 && now.After(s.lastLogCheck) {
+		expected := s.config.LogEventsPerHour * now.Sub(s.lastLogCheck).Hours()
+		count := int(expected)
+		if s.random.Float64() < expected-float64(count) {
+			count++
+		}
+		for i := 0; i < count; i++ {
+			noise := noiseMessages[s.random.Intn(len(noiseMessages))]
+			s.appendLog(now, noise.priority, noise.message+logSuffix)
+		}
+	}
+	s.lastLogCheck = now
+}
+
+// The failure for the next status request, if any: injected ones first, then the rates.
+func (s *Simulator) nextFailure() Failure {
+	if len(s.injected) > 0 {
+		failure := s.injected[0]
+		s.injected = s.injected[1:]
+		return failure
+	}
+	roll := s.random.Float64()
+	for _, f := range []struct {
+		failure Failure
+		rate    float64
+	}{{FailureAuth, s.config.AuthErrorRate}, {FailureTimeout, s.config.TimeoutRate}, {FailureMalformed, s.config.MalformedRate}} {
+		if roll < f.rate {
+			return f.failure
+		}
+		roll -= f.rate
+	}
+	return ""
+}
+
+func (s *Simulator) handleHNAP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	action := path.Base(strings.Trim(r.Header.Get("SOAPAction"), `"`))
+
+	s.mutex.Lock()
+	now := s.now()
+	s.advance(now)
+	if now.Before(s.answersAt) {
+		s.mutex.Unlock()
+		// Rebooting: nobody is listening.
+		panic(http.ErrAbortHandler)
+	}
+	var failure Failure
+	if action != "Login" {
+		failure = s.nextFailure()
+	}
+	if failure == FailureAuth {
+		s.sessions = map[string]bool{}
+	}
+	var response interface{}
+	switch action {
+	case "Login":
+		response = s.login(w, body)
+	case "GetMultipleHNAPs":
+		response = s.multipleHNAPs(r, body, now)
+	case "SetStatusSecuritySettings":
+		response = s.setSecuritySettings(r, body, now)
+	default:
+		response = map[string]interface{}{action + "Response": map[string]string{action + "Result": "ERROR"}}
+	}
+	timeout := s.config.Timeout
+	s.mutex.Unlock()
+
+	if failure == FailureTimeout {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(timeout):
+		}
+		panic(http.ErrAbortHandler)
+	}
+	data, _ := json.Marshal(response)
+	if failure == FailureMalformed {
+		data = data[:len(data)/2]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *Simulator) authenticated(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	return err == nil && s.sessions[cookie.Value]
+}
+
+func (s *Simulator) login(w http.ResponseWriter, body []byte) interface{} {
+	var request struct {
+		Action       string `json:"Action"`
+		Username     string `json:"Username"`
+		PrivateLogin string `json:"PrivateLogin"`
+	}
+	json.Unmarshal(body, &request)
+	result := map[string]string{"Challenge": "", "Cookie": "", "PublicKey": "", "LoginResult": "FAILED"}
+	if request.Username == s.config.Username && request.PrivateLogin == s.config.Password {
+		session := randomHex(16)
+		s.sessions[session] = true
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: session, Path: "/"})
+		result["Challenge"], result["Cookie"], result["PublicKey"] = randomHex(10), session, randomHex(10)
+		result["LoginResult"] = "OK"
+	}
+	return map[string]interface{}{"LoginResponse": result}
+}
+
+func (s *Simulator) multipleHNAPs(r *http.Request, body []byte, now time.Time) interface{} {
+	if !s.authenticated(r) {
+		return map[string]interface{}{"GetMultipleHNAPsResponse": map[string]string{"GetMultipleHNAPsResult": "UN-AUTH"}}
+	}
+	var request struct {
+		GetMultipleHNAPs map[string]string `json:"GetMultipleHNAPs"`
+	}
+	json.Unmarshal(body, &request)
+	responses := map[string]interface{}{"GetMultipleHNAPsResult": "OK"}
+	for action := range request.GetMultipleHNAPs {
+		fields := s.status(action, now)
+		if fields == nil {
+			fields = map[string]string{action + "Result": "ERROR"}
+		} else {
+			fields[action+"Result"] = "OK"
+		}
+		responses[action+"Response"] = fields
+	}
+	return map[string]interface{}{"GetMultipleHNAPsResponse": responses}
+}
+
+func (s *Simulator) setSecuritySettings(r *http.Request, body []byte, now time.Time) interface{} {
+	result := "UN-AUTH"
+	if s.authenticated(r) {
+		var request struct {
+			Settings struct {
+				Action string `json:"MotoStatusSecurityAction"`
+			} `json:"SetStatusSecuritySettings"`
+		}
+		json.Unmarshal(body, &request)
+		result = "OK"
+		if request.Settings.Action == "1" {
+			s.reboot(now, "HNAP reboot")
+		}
+	}
+	return map[string]interface{}{"SetStatusSecuritySettingsResponse": map[string]string{"SetStatusSecuritySettingsResult": result}}
+}
+
+// The fields of a single status action, or nil for actions the simulator does not know.
+func (s *Simulator) status(action string, now time.Time) map[string]string {
+	locked := !now.Before(s.lockedAt)
+	switch action {
+	case "GetMotoStatusStartupSequence":
+		status, comment := "In Progress", "In Progress"
+		if locked {
+			status, comment = "OK", "Operational"
+		}
+		return map[string]string{
+			"MotoConnDSFreq":                   "483000000",
+			"MotoConnDSComment":                "Locked",
+			"MotoConnConnectivityStatus":       status,
+			"MotoConnConnectivityComment":      comment,
+			"MotoConnBootStatus":               status,
+			"MotoConnBootComment":              comment,
+			"MotoConnConfigurationFileStatus":  status,
+			"MotoConnConfigurationFileComment": "d11_m_mb8611_gigabit_c01.cfg",
+			"MotoConnSecurityStatus":           "Enabled",
+			"MotoConnSecurityComment":          "BPI+",
+		}
+	case "GetMotoStatusConnectionInfo":
+		access := "Denied"
+		if locked {
+			access = "Allowed"
+		}
+		return map[string]string{"MotoConnSystemUpTime": formatUptime(now.Sub(s.bootedAt)), "MotoConnNetworkAccess": access}
+	case "GetMotoStatusDownstreamChannelInfo":
+		return map[string]string{"MotoConnDownstreamChannel": s.downstreamChannels(now)}
+	case "GetMotoStatusUpstreamChannelInfo":
+		return map[string]string{"MotoConnUpstreamChannel": s.upstreamChannels(now)}
+	case "GetMotoLagStatus":
+		return map[string]string{"MotoLagCurrentStatus": "1"}
+	case "GetMotoStatusSoftware":
+		return map[string]string{
+			"StatusSoftwareSpecVer":     "DOCSIS 3.1",
+			"StatusSoftwareHdVer":       "V1.0",
+			"StatusSoftwareSfVer":       "8611-19.2.18",
+			"StatusSoftwareCustomerVer": "Prod_19.2_d31",
+			"StatusSoftwareSerialNum":   "2480-MB8611-30-1234",
+			"StatusSoftwareMac":         "00:40:36:aa:bb:cc",
+			"StatusSoftwareCertificate": "Installed",
+		}
+	case "GetMotoStatusLog":
+		return map[string]string{"MotoStatusLogList": s.logList()}
+	case "GetMotoStatusLogXXX":
+		return map[string]string{"XXX": ""}
+	}
+	return nil
+}
+
+// Rows of "^"-separated fields, each ending in "^", joined by "|+|".
+func joinRows(rows []string) string {
+	return strings.Join(rows, "|+|")
+}
+
+// Codeword counters since the channels locked, spread a little between channels.
+func (s *Simulator) counter(perMinute float64, channel int, now time.Time) int64 {
+	if now.Before(s.lockedAt) {
+		return 0
+	}
+	return int64(perMinute * now.Sub(s.lockedAt).Minutes() * (1 + 0.3*math.Sin(float64(channel))))
+}
+
+func (s *Simulator) noise() float64 {
+	return s.random.NormFloat64() * s.config.Noise
+}
+
+func lockStatus(locked bool, channel int, unlocked []int) string {
+	if !locked {
+		return "Not Locked"
+	}
+	for _, c := range unlocked {
+		if c == channel {
+			return "Not Locked"
+		}
+	}
+	return "Locked"
+}
+
+func (s *Simulator) downstreamChannels(now time.Time) string {
+	locked := !now.Before(s.lockedAt)
+	var rows []string
+	total := s.config.Downstream + s.config.OFDM
+	for channel := 1; channel <= total; channel++ {
+		status := lockStatus(locked, channel, s.config.UnlockedDownstream)
+		power, snr := 0.0, 0.0
+		if status == "Locked" {
+			power = s.config.DownstreamPower + 1.5*math.Sin(float64(channel)/3) + s.noise()
+			snr = s.config.DownstreamSNR + 0.5*math.Cos(float64(channel)/4) + s.noise()
+		}
+		corrected := s.counter(s.config.CorrectedPerMinute, channel, now)
+		uncorrected := s.counter(s.config.UncorrectedPerMinute, channel, now)
+		if channel <= s.config.Downstream {
+			rows = append(rows, fmt.Sprintf("%d^%s^QAM256^%d^%.1f^ %.1f^%.1f^%d^%d^",
+				channel, status, channel, 483+6*float64(channel-1), power, snr, corrected, uncorrected))
+		} else {
+			ofdm := channel - s.config.Downstream - 1
+			rows = append(rows, fmt.Sprintf("%d^%s^OFDM PLC^%d^%.1f^ %.1f^%.1f^%d^%d^",
+				channel, status, 193+ofdm, 957+96*float64(ofdm), power, snr, corrected*20, uncorrected))
+		}
+	}
+	return joinRows(rows)
+}
+
+func (s *Simulator) upstreamChannels(now time.Time) string {
+	locked := !now.Before(s.lockedAt)
+	var rows []string
+	total := s.config.Upstream + s.config.OFDMA
+	for channel := 1; channel <= total; channel++ {
+		status := lockStatus(locked, channel, s.config.UnlockedUpstream)
+		power := 0.0
+		if status == "Locked" {
+			power = s.config.UpstreamPower + 0.75*math.Sin(float64(channel)) + s.noise()
+		}
+		if channel <= s.config.Upstream {
+			rows = append(rows, fmt.Sprintf("%d^%s^SC-QAM^%d^5120^%.1f^%.1f^",
+				channel, status, channel, 16.4+6.4*float64(channel-1), power))
+		} else {
+			ofdma := channel - s.config.Upstream - 1
+			rows = append(rows, fmt.Sprintf("%d^%s^OFDMA^%d^0^%.1f^%.1f^",
+				channel, status, 41+ofdma, 39.8+float64(ofdma), power))
+		}
+	}
+	return joinRows(rows)
+}
+
+// Entries oldest first, as "time\n^date^priority^message", joined by "}-{".
+func (s *Simulator) logList() string {
+	entries := make([]string, 0, len(s.log))
+	for _, entry := range s.log {
+		clock, date := timeNotEstablished, timeNotEstablished
+		if !entry.time.IsZero() {
+			local := entry.time.Local()
+			clock, date = local.Format(logTimeLayout), local.Format(logDateLayout)
+		}
+		entries = append(entries, fmt.Sprintf("%s\n^%s^%d^%s", clock, date, entry.priority, entry.message))
+	}
+	return strings.Join(entries, "}-{")
+}
+
+// Formatted the way the modem does, e.g. "2 days 05h:12m:33s".
+func formatUptime(d time.Duration) string {
+	seconds := int64(d.Seconds())
+	return fmt.Sprintf("%d days %02dh:%02dm:%02ds", seconds/86400, seconds%86400/3600, seconds%3600/60, seconds%60)
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return strings.ToUpper(hex.EncodeToString(buf))
+}
+
+func (s *Simulator) handleReboot(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	s.Reboot()
+	fmt.Fprintln(w, "rebooting")
+}
+
+func (s *Simulator) handleFail(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	failure := Failure(r.URL.Query().Get("type"))
+	known := false
+	for _, f := range Failures {
+		known = known || f == failure
+	}
+	if !known {
+		http.Error(w, fmt.Sprintf("unknown failure %q", failure), http.StatusBadRequest)
+		return
+	}
+	count := 1
+	if value := r.URL.Query().Get("count"); value != "" {
+		var err error
+		if count, err = strconv.Atoi(value); err != nil || count < 1 {
+			http.Error(w, fmt.Sprintf("invalid count %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+	s.Inject(failure, count)
+	fmt.Fprintf(w, "failing the next %d status requests with %s\n", count, failure)
+}
+
+func (s *Simulator) handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		config := s.Config()
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.SetConfig(config)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Config())
+}
+
+func (s *Simulator) handleLog(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	priority, err := strconv.Atoi(r.URL.Query().Get("priority"))
+	message := r.URL.Query().Get("message")
+	if err != nil || message == "" {
+		http.Error(w, "priority and message are required", http.StatusBadRequest)
+		return
+	}
+	s.AddLogEntry(priority, message)
+	fmt.Fprintln(w, "logged")
+}
+
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,22 @@
+package simulator
+
+import (
+	"net/http/httptest"
+)
+
+// A simulator behind an httptest TLS server, the way the modem serves HNAP over HTTPS with a
+// self-signed certificate. Close it when done.
+type TestServer struct {
+	*httptest.Server
+	Simulator *Simulator
+}
+
+func NewTestServer(config Config) *TestServer {
+	sim := New(config)
+	return &TestServer{Server: httptest.NewTLSServer(sim), Simulator: sim}
+}
+
+// The address to hand to mb8611.NewClient.
+func (t *TestServer) Endpoint() string {
+	return t.URL + "/HNAP1/"
+}
@@ -0,0 +1,308 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/alerts"
+	"github.com/RickyGrassmuck/modem_logs/health"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+)
+
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+)
+
+type EmailConfig struct {
+	Host               string
+	Port               int
+	TLSMode            string
+	InsecureSkipVerify bool
+	Username           string
+	Password           string
+	From               string
+	To                 []string
+	ModemName          string
+	TextTemplatePath   string
+	HTMLTemplatePath   string
+}
+
+type ChannelRow struct {
+	Direction string
+	Cells     []string
+	Verdict   thresholds.Verdict
+}
+
+type emailData struct {
+	Modem      string
+	Subject    string
+	Time       time.Time
+	Alert      *alerts.Alert
+	Active     []alerts.Alert
+	Health     *health.Score
+	Connection *modem.Connection
+	Headers    map[string][]string
+	Channels   []ChannelRow
+}
+
+// Sends alert and digest emails over SMTP. The latest snapshot set through SetSnapshot is
+// embedded in every message as a channel table.
+type EmailNotifier struct {
+	config EmailConfig
+	text   *texttemplate.Template
+	html   *htmltemplate.Template
+	mutex  sync.Mutex
+	conn   *modem.Connection
+	report *thresholds.Report
+	score  *health.Score
+}
+
+func NewEmailNotifier(config EmailConfig) (*EmailNotifier, error) {
+	if config.Host == "" || config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("email notifier needs a host, a sender and at least one recipient")
+	}
+	switch config.TLSMode {
+	case TLSNone, TLSStartTLS, TLSImplicit:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q", config.TLSMode)
+	}
+	n := &EmailNotifier{config: config, text: textTemplate, html: htmlTemplate}
+	if config.TextTemplatePath != "" {
+		t, err := texttemplate.ParseFiles(config.TextTemplatePath)
+		if err != nil {
+			return nil, err
+		}
+		n.text = t
+	}
+	if config.HTMLTemplatePath != "" {
+		t, err := htmltemplate.ParseFiles(config.HTMLTemplatePath)
+		if err != nil {
+			return nil, err
+		}
+		n.html = t
+	}
+	return n, nil
+}
+
+func (n *EmailNotifier) SetSnapshot(conn *modem.Connection, report *thresholds.Report, score *health.Score) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.conn, n.report, n.score = conn, report, score
+}
+
+func (n *EmailNotifier) Notify(alert alerts.Alert) error {
+	subject := fmt.Sprintf("[%s] %s: %s (%s)", n.config.ModemName, strings.ToUpper(string(alert.State)), alert.Rule, alert.Severity)
+	data := n.data(subject)
+	data.Alert = &alert
+	return n.send(data)
+}
+
+// Send a summary of the current snapshot, health score and active alerts.
+func (n *EmailNotifier) SendDigest(active []alerts.Alert) error {
+	data := n.data(fmt.Sprintf("[%s] Modem summary", n.config.ModemName))
+	data.Active = active
+	return n.send(data)
+}
+
+func (n *EmailNotifier) data(subject string) *emailData {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	data := &emailData{
+		Modem:      n.config.ModemName,
+		Subject:    subject,
+		Time:       time.Now(),
+		Health:     n.score,
+		Connection: n.conn,
+		Headers: map[string][]string{
+			"Downstream": headerStrings(modem.DownstreamHeaders),
+			"Upstream":   headerStrings(modem.UpstreamHeaders),
+		},
+	}
+	if n.conn == nil {
+		return data
+	}
+	for _, direction := range []struct {
+		name     string
+		details  modem.ConnectionDetails
+		verdicts map[int]thresholds.ChannelVerdict
+	}{
+		{"Downstream", n.conn.Downstream, n.report.Downstream},
+		{"Upstream", n.conn.Upstream, n.report.Upstream},
+	} {
+		for _, record := range direction.details.ToCSV() {
+			row := ChannelRow{Direction: direction.name, Cells: record}
+			var channel int
+			fmt.Sscan(record[0], &channel)
+			row.Verdict = direction.verdicts[channel].Verdict
+			data.Channels = append(data.Channels, row)
+		}
+	}
+	return data
+}
+
+func (n *EmailNotifier) send(data *emailData) error {
+	message, err := n.buildMessage(data)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(n.config.Host, fmt.Sprint(n.config.Port))
+	tlsConfig := &tls.Config{ServerName: n.config.Host, InsecureSkipVerify: n.config.InsecureSkipVerify}
+
+	var client *smtp.Client
+	if n.config.TLSMode == TLSImplicit {
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return err
+		}
+		client, err = smtp.NewClient(conn, n.config.Host)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	} else {
+		client, err = smtp.Dial(addr)
+		if err != nil {
+			return err
+		}
+	}
+	defer client.Close()
+
+	if n.config.TLSMode == TLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.config.From); err != nil {
+		return err
+	}
+	for _, to := range n.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (n *EmailNotifier) buildMessage(data *emailData) ([]byte, error) {
+	var textBody, htmlBody bytes.Buffer
+	if err := n.text.Execute(&textBody, data); err != nil {
+		return nil, err
+	}
+	if err := n.html.Execute(&htmlBody, data); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	body := multipart.NewWriter(&message)
+	fmt.Fprintf(&message, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", data.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", data.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", body.Boundary())
+
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", textBody.Bytes()},
+		{"text/html; charset=utf-8", htmlBody.Bytes()},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		qp.Write(part.content)
+		qp.Close()
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+func headerStrings(headers []interface{}) []string {
+	var ret []string
+	for _, h := range headers {
+		ret = append(ret, fmt.Sprint(h))
+	}
+	return ret
+}
+
+var textTemplate = texttemplate.Must(texttemplate.New("text").Parse(`{{.Subject}}
+{{with .Alert}}
+Rule:        {{.Rule}}
+State:       {{.State}}
+Severity:    {{.Severity}}
+Value:       {{.Value}}
+Description: {{.Description}}
+Active since {{.ActiveSince.Format "2006-01-02 15:04:05 MST"}}
+{{range $k, $v := .Labels}}{{$k}}={{$v}}
+{{end}}{{end}}{{if .Active}}
+Active alerts:
+{{range .Active}}  - {{.Rule}} ({{.Severity}}, {{.State}}): {{.Description}}
+{{end}}{{end}}{{with .Health}}
+Health score: {{printf "%.1f" .Value}} / 100
+{{range .Factors}}  -{{printf "%.1f" .Penalty}} {{.Name}}: {{.Detail}}
+{{end}}{{end}}{{with .Connection}}
+Connectivity: {{.ConnectivityStatus}}   Uptime: {{.Uptime}}
+{{end}}{{range .Channels}}{{.Direction}}	{{range .Cells}}{{.}}	{{end}}{{.Verdict}}
+{{end}}`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<html><body style="font-family: sans-serif">
+<h2>{{.Subject}}</h2>
+{{with .Alert}}<table>
+<tr><th align="left">Rule</th><td>{{.Rule}}</td></tr>
+<tr><th align="left">State</th><td>{{.State}}</td></tr>
+<tr><th align="left">Severity</th><td>{{.Severity}}</td></tr>
+<tr><th align="left">Value</th><td>{{.Value}}</td></tr>
+<tr><th align="left">Description</th><td>{{.Description}}</td></tr>
+<tr><th align="left">Active since</th><td>{{.ActiveSince.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{range $k, $v := .Labels}}<tr><th align="left">{{$k}}</th><td>{{$v}}</td></tr>{{end}}
+</table>{{end}}
+{{if .Active}}<h3>Active alerts</h3><ul>{{range .Active}}<li><b>{{.Rule}}</b> ({{.Severity}}, {{.State}}): {{.Description}}</li>{{end}}</ul>{{end}}
+{{with .Health}}<h3>Health score: {{printf "%.1f" .Value}} / 100</h3>
+{{if .Factors}}<ul>{{range .Factors}}<li>-{{printf "%.1f" .Penalty}} {{.Name}}: {{.Detail}}</li>{{end}}</ul>{{end}}{{end}}
+{{with .Connection}}<p>Connectivity: {{.ConnectivityStatus}}, uptime: {{.Uptime}}</p>{{end}}
+{{$headers := .Headers}}{{$channels := .Channels}}
+{{range $name, $cols := $headers}}<h3>{{$name}}</h3>
+<table border="1" cellpadding="4" cellspacing="0" style="border-collapse: collapse">
+<tr>{{range $cols}}<th>{{.}}</th>{{end}}<th>Verdict</th></tr>
+{{range $channels}}{{if eq .Direction $name}}<tr>{{range .Cells}}<td>{{.}}</td>{{end}}<td style="color: {{if eq .Verdict "good"}}green{{else if eq .Verdict "marginal"}}orange{{else}}red{{end}}">{{.Verdict}}</td></tr>{{end}}{{end}}
+</table>{{end}}
+</body></html>`))
@@ -0,0 +1,195 @@
+package notify_test
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/alerts"
+	"github.com/RickyGrassmuck/modem_logs/health"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/modem/mb8611/simulator"
+	"github.com/RickyGrassmuck/modem_logs/notify"
+	"github.com/RickyGrassmuck/modem_logs/notify/smtptest"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+)
+
+// A snapshot polled from the simulator, with downstream channel 3 unlocked.
+func snapshot(t *testing.T) (*modem.Connection, *thresholds.Report, *health.Score) {
+	t.Helper()
+	config := simulator.DefaultConfig()
+	config.UnlockedDownstream = []int{3}
+	server := simulator.NewTestServer(config)
+	defer server.Close()
+
+	client, err := modem.NewClient(server.Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Login(config.Username, config.Password); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.GetConnectionDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := thresholds.Load("docsis", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, profile.Evaluate(conn), &health.Score{Value: 82.5}
+}
+
+func newNotifier(t *testing.T, server *smtptest.Server, tlsMode string, password string) *notify.EmailNotifier {
+	t.Helper()
+	host, port := server.HostPort()
+	notifier, err := notify.NewEmailNotifier(notify.EmailConfig{
+		Host:               host,
+		Port:               port,
+		TLSMode:            tlsMode,
+		InsecureSkipVerify: true,
+		Username:           "modem",
+		Password:           password,
+		From:               "modem@example.com",
+		To:                 []string{"alice@example.com", "bob@example.com"},
+		ModemName:          "MB8611",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notifier
+}
+
+// The subject and the decoded text and HTML bodies of a message.
+func parse(t *testing.T, data []byte) (subject, text, html string) {
+	t.Helper()
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err = new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", message.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = string(body)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			html = string(body)
+		}
+	}
+	return subject, text, html
+}
+
+func TestNotifyOverStartTLS(t *testing.T) {
+	server, err := smtptest.NewServer(smtptest.Config{StartTLS: true, Username: "modem", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	notifier := newNotifier(t, server, notify.TLSStartTLS, "secret")
+	notifier.SetSnapshot(snapshot(t))
+	alert := alerts.Alert{
+		Rule:        "downstream_unlocked",
+		State:       alerts.Firing,
+		Severity:    "critical",
+		Value:       "1",
+		Description: "A downstream channel lost lock",
+		ActiveSince: time.Now(),
+	}
+	if err := notifier.Notify(alert); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	message := messages[0]
+	if !message.TLS || message.Username != "modem" {
+		t.Errorf("TLS = %v, username = %q; want a TLS session authenticated as modem", message.TLS, message.Username)
+	}
+	if message.From != "modem@example.com" || strings.Join(message.To, ",") != "alice@example.com,bob@example.com" {
+		t.Errorf("envelope from %q to %v", message.From, message.To)
+	}
+	subject, text, html := parse(t, message.Data)
+	if want := "[MB8611] FIRING: downstream_unlocked (critical)"; subject != want {
+		t.Errorf("subject = %q, want %q", subject, want)
+	}
+	for _, want := range []string{"A downstream channel lost lock", "Health score: 82.5 / 100", "Downstream\t3\tNot Locked"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text body lacks %q:\n%s", want, text)
+		}
+	}
+	for _, want := range []string{"<h3>Downstream</h3>", "<h3>Upstream</h3>", "<td>Not Locked</td>", ">bad</td>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML body lacks %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestDigestOverImplicitTLS(t *testing.T) {
+	server, err := smtptest.NewServer(smtptest.Config{ImplicitTLS: true, Username: "modem", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	notifier := newNotifier(t, server, notify.TLSImplicit, "secret")
+	notifier.SetSnapshot(snapshot(t))
+	active := []alerts.Alert{{Rule: "snr_low", State: alerts.Firing, Severity: "warning", Description: "SNR below 33 dB"}}
+	if err := notifier.SendDigest(active); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 || !messages[0].TLS {
+		t.Fatalf("got %d messages, want 1 over TLS", len(messages))
+	}
+	subject, text, _ := parse(t, messages[0].Data)
+	if want := "[MB8611] Modem summary"; subject != want {
+		t.Errorf("subject = %q, want %q", subject, want)
+	}
+	if !strings.Contains(text, "snr_low (warning, firing): SNR below 33 dB") {
+		t.Errorf("text body lacks the active alert:\n%s", text)
+	}
+}
+
+func TestRejectedLogin(t *testing.T) {
+	server, err := smtptest.NewServer(smtptest.Config{StartTLS: true, Username: "modem", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	notifier := newNotifier(t, server, notify.TLSStartTLS, "wrong")
+	if err := notifier.SendDigest(nil); err == nil {
+		t.Fatal("sending with the wrong password succeeded")
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Errorf("server accepted %d messages", n)
+	}
+}
@@ -0,0 +1,253 @@
+// Package smtptest provides a local SMTP stand-in for testing the email notifier. It speaks just
+// enough SMTP for net/smtp: EHLO, STARTTLS, AUTH PLAIN, MAIL, RCPT, DATA, RSET, NOOP and QUIT.
+package smtptest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Offer STARTTLS after EHLO.
+	StartTLS bool
+	// Speak TLS from the first byte, as on port 465.
+	ImplicitTLS bool
+	// When set, MAIL is refused until the client has authenticated with these credentials.
+	Username string
+	Password string
+}
+
+// A message the server accepted.
+type Message struct {
+	From string
+	To   []string
+	Data []byte
+	// Who the client authenticated as, if anyone.
+	Username string
+	// Whether the message arrived over TLS.
+	TLS bool
+}
+
+// An SMTP server on a loopback port with a self-signed certificate. Close it when done.
+type Server struct {
+	// The host:port to hand to the notifier.
+	Addr string
+
+	config    Config
+	tlsConfig *tls.Config
+	listener  net.Listener
+	wg        sync.WaitGroup
+	mutex     sync.Mutex
+	messages  []Message
+}
+
+func NewServer(config Config) (*Server, error) {
+	cert, err := selfSigned()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{config: config, tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}}}
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if config.ImplicitTLS {
+		s.listener = tls.NewListener(s.listener, s.tlsConfig)
+	}
+	s.Addr = s.listener.Addr().String()
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// The host and port of Addr, split the way the notifier's config wants them.
+func (s *Server) HostPort() (string, int) {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	var p int
+	fmt.Sscan(port, &p)
+	return host, p
+}
+
+// The messages accepted so far, oldest first.
+func (s *Server) Messages() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Stop listening and wait for open sessions to end.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.session(conn)
+		}()
+	}
+}
+
+type session struct {
+	conn     net.Conn
+	text     *textproto.Conn
+	tls      bool
+	username string
+	message  *Message
+}
+
+func (s *Server) session(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	sess := &session{conn: conn, text: textproto.NewConn(conn), tls: s.config.ImplicitTLS}
+	sess.reply(220, "smtptest ESMTP ready")
+	for {
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"smtptest", "8BITMIME"}
+			if s.config.StartTLS && !sess.tls {
+				lines = append(lines, "STARTTLS")
+			}
+			if s.config.Username != "" {
+				lines = append(lines, "AUTH PLAIN")
+			}
+			sess.reply(250, lines...)
+		case "STARTTLS":
+			if !s.config.StartTLS || sess.tls {
+				sess.reply(502, "STARTTLS not available")
+				continue
+			}
+			sess.reply(220, "Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			sess.conn, sess.text, sess.tls = tlsConn, textproto.NewConn(tlsConn), true
+			sess.username, sess.message = "", nil
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mechanism, "PLAIN") || initial == "" {
+				sess.reply(504, "Only AUTH PLAIN with an initial response is supported")
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(decoded), "\x00")
+			if err != nil || len(parts) != 3 || parts[1] != s.config.Username || parts[2] != s.config.Password {
+				sess.reply(535, "Authentication failed")
+				continue
+			}
+			sess.username = parts[1]
+			sess.reply(235, "Authentication successful")
+		case "MAIL":
+			if s.config.Username != "" && sess.username == "" {
+				sess.reply(530, "Authentication required")
+				continue
+			}
+			sess.message = &Message{From: address(arg), Username: sess.username, TLS: sess.tls}
+			sess.reply(250, "OK")
+		case "RCPT":
+			if sess.message == nil {
+				sess.reply(503, "MAIL first")
+				continue
+			}
+			sess.message.To = append(sess.message.To, address(arg))
+			sess.reply(250, "OK")
+		case "DATA":
+			if sess.message == nil || len(sess.message.To) == 0 {
+				sess.reply(503, "RCPT first")
+				continue
+			}
+			sess.reply(354, "End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(sess.text.DotReader())
+			if err != nil {
+				return
+			}
+			sess.message.Data = data
+			s.mutex.Lock()
+			s.messages = append(s.messages, *sess.message)
+			s.mutex.Unlock()
+			sess.message = nil
+			sess.reply(250, "OK")
+		case "RSET":
+			sess.message = nil
+			sess.reply(250, "OK")
+		case "NOOP":
+			sess.reply(250, "OK")
+		case "QUIT":
+			sess.reply(221, "Bye")
+			return
+		default:
+			sess.reply(502, "Command not implemented")
+		}
+	}
+}
+
+// Write a reply, using the multi-line form when there is more than one line.
+func (s *session) reply(code int, lines ...string) {
+	w := bufio.NewWriter(s.conn)
+	for i, line := range lines {
+		separator := "-"
+		if i == len(lines)-1 {
+			separator = " "
+		}
+		fmt.Fprintf(w, "%d%s%s\r\n", code, separator, line)
+	}
+	w.Flush()
+}
+
+// The address in a "FROM:<a@b>" or "TO:<a@b>" argument.
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
+
+func selfSigned() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtptest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/outages"
+	"github.com/RickyGrassmuck/modem_logs/utils"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+func printOutages(summary outages.Summary, since time.Time) {
+	outageTable := table.NewWriter()
+	outageTable.SetTitle("OUTAGES SINCE %s", since.Local().Format("2006-01-02 15:04"))
+	outageTable.SetStyle(table.StyleLight)
+	outageTable.Style().Title.Align = text.AlignCenter
+	outageTable.Style().Format.Footer = text.FormatDefault
+	outageTable.SetOutputMirror(os.Stdout)
+	outageTable.AppendHeader(table.Row{"Start", "End", "Duration", "Probable Cause"})
+	for _, o := range summary.Outages {
+		end := o.End.Local().Format("2006-01-02 15:04:05")
+		if o.Ongoing {
+			end = "ongoing"
+		}
+		outageTable.AppendRow(table.Row{
+			o.Start.Local().Format("2006-01-02 15:04:05"),
+			end,
+			o.Duration().Round(time.Second),
+			text.WrapSoft(o.Cause, 60),
+		})
+	}
+	outageTable.AppendFooter(table.Row{"Total downtime", "", summary.Downtime.Round(time.Second),
+		fmt.Sprintf("availability %.3f%% of %s monitored", summary.Availability, summary.Monitored.Round(time.Minute))})
+	outageTable.Render()
+	if summary.Unmonitored > 0 {
+		fmt.Printf("%s without any polls were excluded.\n", summary.Unmonitored.Round(time.Minute))
+	}
+}
+
+func runOutages(args []string) {
+	flags := flag.NewFlagSet("outages", flag.ExitOnError)
+	sinceFlag := flags.String("since", "30d", "how far back to look, e.g. 24h, 30d or 2026-01-01")
+	journalPath := flags.String("journal", defaultJournalFileName, "journal file written by the collector (default $MODEM_JOURNAL)")
+	maxGap := flags.Duration("max-gap", time.Minute, "longest gap between polls that still counts as continuous monitoring")
+	flags.Parse(args)
+	if envJournal, ok := os.LookupEnv("MODEM_JOURNAL"); ok && !flagWasSet(flags, "journal") {
+		*journalPath = envJournal
+	}
+
+	now := time.Now().UTC()
+	since, err := utils.ParseSince(*sinceFlag, now)
+	if err != nil {
+		logger.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	observations, entries, err := outages.NewJournal(*journalPath, 0).Read(since)
+	if err != nil {
+		logger.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	printOutages(outages.Analyze(observations, entries, *maxGap, now), since)
+}
@@ -0,0 +1,163 @@
+package outages
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+)
+
+// The outcome of a single poll as far as outage analysis is concerned.
+type Observation struct {
+	Time             time.Time     `json:"time"`
+	Reachable        bool          `json:"reachable"`
+	Connectivity     string        `json:"connectivity,omitempty"`
+	LockedDownstream int           `json:"locked_downstream"`
+	TotalDownstream  int           `json:"total_downstream"`
+	Uptime           time.Duration `json:"uptime"`
+}
+
+func (o Observation) Up() bool {
+	return o.Reachable && o.Connectivity == "OK" && o.LockedDownstream > 0
+}
+
+type journalLine struct {
+	Type        string          `json:"type"`
+	Observation *Observation    `json:"observation,omitempty"`
+	LogEntry    *modem.LogEntry `json:"log_entry,omitempty"`
+}
+
+// How often Record drops the lines that have aged out.
+const pruneInterval = time.Hour
+
+// A JSON lines file of poll observations and modem log entries. New lines are appended; once
+// an hour, the lines recorded before the retention period are dropped.
+type Journal struct {
+	path string
+	// Zero keeps every line.
+	retention time.Duration
+	mutex     sync.Mutex
+	pruned    time.Time
+}
+
+func NewJournal(path string, retention time.Duration) *Journal {
+	return &Journal{path: path, retention: retention}
+}
+
+func (j *Journal) Record(obs Observation, entries []modem.LogEntry) error {
+	lines := []journalLine{{Type: "poll", Observation: &obs}}
+	for i := range entries {
+		lines = append(lines, journalLine{Type: "log", LogEntry: &entries[i]})
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	// Pruning goes by the time of the observation rather than the clock, so that replayed polls
+	// age out the same way.
+	var pruneErr error
+	if j.retention > 0 && obs.Time.Sub(j.pruned) >= pruneInterval {
+		pruneErr = j.prune(obs.Time.Add(-j.retention))
+		j.pruned = obs.Time
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	for _, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return pruneErr
+}
+
+// Drop the lines before the first observation made at or after cutoff. Log entries are kept
+// along with the polls around them, as those the modem logged before it learned the time of
+// day carry no time of their own.
+func (j *Journal) prune(cutoff time.Time) error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	dropped, found := 0, false
+	for !found && scanner.Scan() {
+		var line journalLine
+		found = json.Unmarshal(scanner.Bytes(), &line) == nil && line.Observation != nil && !line.Observation.Time.Before(cutoff)
+		if !found {
+			dropped++
+		}
+	}
+	if err := scanner.Err(); err != nil || dropped == 0 {
+		return err
+	}
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	w := bufio.NewWriter(tmp)
+	// The scanner stopped on the first line to keep.
+	if found {
+		w.Write(scanner.Bytes())
+		w.WriteByte('\n')
+	}
+	for scanner.Scan() {
+		w.Write(scanner.Bytes())
+		w.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, j.path)
+}
+
+// Read the observations and log entries recorded at or after since.
+func (j *Journal) Read(since time.Time) ([]Observation, []modem.LogEntry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var observations []Observation
+	var entries []modem.LogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line journalLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		switch {
+		case line.Observation != nil && !line.Observation.Time.Before(since):
+			observations = append(observations, *line.Observation)
+		case line.LogEntry != nil && !line.LogEntry.Time.Before(since):
+			entries = append(entries, *line.LogEntry)
+		}
+	}
+	return observations, entries, scanner.Err()
+}
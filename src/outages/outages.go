@@ -0,0 +1,183 @@
+package outages
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/docsis"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+)
+
+type Outage struct {
+	Start   time.Time
+	End     time.Time
+	Cause   string
+	Ongoing bool
+}
+
+func (o Outage) Duration() time.Duration {
+	return o.End.Sub(o.Start)
+}
+
+type Summary struct {
+	Outages []Outage
+	// Time covered by observations. Gaps with no record of the modem at all (the collector
+	// was not running) are excluded rather than counted as downtime.
+	Monitored    time.Duration
+	Unmonitored  time.Duration
+	Downtime     time.Duration
+	Availability float64
+}
+
+// How long a category of log event can precede an outage and still be blamed for it.
+const causeLookback = 2 * time.Minute
+
+// How long a reboot that happened while nobody was watching is taken to have kept the modem
+// down: about as long as the modem takes to restart and lock its channels again.
+const bootWindow = 5 * time.Minute
+
+var causeCategories = map[string]bool{
+	docsis.CategoryRanging:      true,
+	docsis.CategorySync:         true,
+	docsis.CategoryDHCP:         true,
+	docsis.CategoryProvisioning: true,
+	docsis.CategorySecurity:     true,
+	docsis.CategoryReboot:       true,
+}
+
+// Reconstruct outage intervals from poll observations and classified log entries.
+//
+// The modem counts as down while polls fail, connectivity is not "OK" or no downstream
+// channel is locked. A drop in uptime between polls marks a reboot, and the outage is taken
+// to start at the reboot time. A gap longer than maxGap between polls is reported as
+// unmonitored, unless the modem was already down when it began. A reboot inside such a gap
+// counts as an outage of at most bootWindow, as the modem may have been up for most of it.
+func Analyze(observations []Observation, entries []modem.LogEntry, maxGap time.Duration, until time.Time) Summary {
+	sort.Slice(observations, func(i, j int) bool { return observations[i].Time.Before(observations[j].Time) })
+
+	var summary Summary
+	var current *Outage
+	var lastReachable *Observation
+	openOutage := func(start time.Time, cause string) {
+		if current == nil {
+			current = &Outage{Start: start, Cause: cause}
+		}
+	}
+	closeOutage := func(end time.Time) {
+		if current == nil {
+			return
+		}
+		current.End = end
+		summary.Outages = append(summary.Outages, *current)
+		current = nil
+	}
+
+	for i, obs := range observations {
+		var gap time.Duration
+		if i > 0 {
+			gap = obs.Time.Sub(observations[i-1].Time)
+		}
+		longGap := gap > maxGap
+
+		rebooted := false
+		var rebootTime time.Time
+		if obs.Reachable && lastReachable != nil && obs.Uptime > 0 {
+			expected := lastReachable.Uptime + obs.Time.Sub(lastReachable.Time)
+			rebooted = obs.Uptime < expected-maxGap
+			rebootTime = obs.Time.Add(-obs.Uptime)
+			if rebootTime.Before(lastReachable.Time) {
+				rebootTime = lastReachable.Time
+			}
+		}
+		switch {
+		case rebooted && longGap:
+			// Nobody saw how long the modem was down for, only that it restarted. An outage that
+			// was open when the gap began is taken to have lasted until it was back.
+			watched := rebootTime
+			if current != nil {
+				watched = observations[i-1].Time
+			}
+			end := rebootTime.Add(bootWindow)
+			if end.After(obs.Time) {
+				end = obs.Time
+			}
+			if end.Before(watched) {
+				end = watched
+			}
+			openOutage(rebootTime, "modem rebooted")
+			current.Cause = "modem rebooted"
+			closeOutage(end)
+			summary.Monitored += end.Sub(watched)
+			summary.Unmonitored += gap - end.Sub(watched)
+		case rebooted:
+			openOutage(rebootTime, "modem rebooted")
+			current.Cause = "modem rebooted"
+			summary.Monitored += gap
+		case longGap && current == nil:
+			summary.Unmonitored += gap
+		default:
+			summary.Monitored += gap
+		}
+		if obs.Reachable {
+			lastReachable = &observations[i]
+		}
+
+		switch {
+		case !obs.Reachable:
+			openOutage(obs.Time, "modem unreachable")
+		case obs.LockedDownstream == 0:
+			openOutage(obs.Time, "no downstream channels locked")
+		case obs.Connectivity != "OK":
+			openOutage(obs.Time, fmt.Sprintf("connectivity %q", obs.Connectivity))
+		default:
+			closeOutage(obs.Time)
+		}
+	}
+	if current != nil {
+		current.End = until
+		current.Ongoing = true
+		if n := len(observations); n > 0 {
+			summary.Monitored += until.Sub(observations[n-1].Time)
+		}
+		summary.Outages = append(summary.Outages, *current)
+	}
+
+	for i := range summary.Outages {
+		if cause := logCause(summary.Outages[i], entries); cause != "" {
+			summary.Outages[i].Cause += "; " + cause
+		}
+		summary.Downtime += summary.Outages[i].Duration()
+	}
+	if summary.Monitored > 0 {
+		summary.Availability = 100 * (1 - summary.Downtime.Seconds()/summary.Monitored.Seconds())
+		if summary.Availability < 0 {
+			summary.Availability = 0
+		}
+	}
+	return summary
+}
+
+// Pick the most severe classified log event around the outage start as its probable cause.
+func logCause(outage Outage, entries []modem.LogEntry) string {
+	var best *modem.LogEntry
+	for i, entry := range entries {
+		if entry.Time.IsZero() || !causeCategories[entry.Event.Category] {
+			continue
+		}
+		if entry.Time.Before(outage.Start.Add(-causeLookback)) || entry.Time.After(outage.End) {
+			continue
+		}
+		if best == nil || entry.Priority < best.Priority {
+			best = &entries[i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	text, _ := best.Attributes()
+	if best.Event.Known() {
+		return fmt.Sprintf("%s %s: %s", best.Event.Category, best.Event.ID, text)
+	}
+	return fmt.Sprintf("%s: %s", best.Event.Category, text)
+}
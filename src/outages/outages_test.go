@@ -0,0 +1,140 @@
+package outages_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/outages"
+)
+
+var start = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// A poll at offset that found the modem up for uptime.
+func up(offset, uptime time.Duration) outages.Observation {
+	return outages.Observation{Time: start.Add(offset), Reachable: true, Connectivity: "OK", LockedDownstream: 32, TotalDownstream: 32, Uptime: uptime}
+}
+
+// A poll at offset that got no answer.
+func down(offset time.Duration) outages.Observation {
+	return outages.Observation{Time: start.Add(offset)}
+}
+
+// Polls once a minute from offset to offset+d, with the modem up since boot.
+func upFor(offset, d, boot time.Duration) []outages.Observation {
+	var observations []outages.Observation
+	for t := offset; t <= offset+d; t += time.Minute {
+		observations = append(observations, up(t, t-boot))
+	}
+	return observations
+}
+
+func concat(parts ...[]outages.Observation) []outages.Observation {
+	var observations []outages.Observation
+	for _, part := range parts {
+		observations = append(observations, part...)
+	}
+	return observations
+}
+
+type span struct {
+	start, end time.Duration
+	ongoing    bool
+}
+
+func TestAnalyze(t *testing.T) {
+	const day = 24 * time.Hour
+	for _, tc := range []struct {
+		name         string
+		observations []outages.Observation
+		until        time.Duration
+		outages      []span
+		monitored    time.Duration
+		unmonitored  time.Duration
+	}{
+		{
+			name:         "up throughout",
+			observations: upFor(0, 10*time.Minute, -day),
+			until:        10 * time.Minute,
+			monitored:    10 * time.Minute,
+		},
+		{
+			name:         "failed polls",
+			observations: concat(upFor(0, time.Minute, -day), []outages.Observation{down(2 * time.Minute), down(3 * time.Minute)}, upFor(4*time.Minute, time.Minute, -day)),
+			until:        5 * time.Minute,
+			outages:      []span{{start: 2 * time.Minute, end: 4 * time.Minute}},
+			monitored:    5 * time.Minute,
+		},
+		{
+			name:         "reboot between polls",
+			observations: concat(upFor(0, 3*time.Minute, -day), upFor(4*time.Minute, time.Minute, 3*time.Minute+30*time.Second)),
+			until:        5 * time.Minute,
+			outages:      []span{{start: 3*time.Minute + 30*time.Second, end: 4 * time.Minute}},
+			monitored:    5 * time.Minute,
+		},
+		{
+			// The collector was down for 7 hours and the modem restarted 5 hours before it came
+			// back. Only the restart itself counts as downtime.
+			name:         "reboot while nobody watched",
+			observations: concat(upFor(0, time.Minute, -day), upFor(8*time.Hour, time.Minute, 3*time.Hour)),
+			until:        8*time.Hour + time.Minute,
+			outages:      []span{{start: 3 * time.Hour, end: 3*time.Hour + 5*time.Minute}},
+			monitored:    time.Minute + 5*time.Minute + time.Minute,
+			unmonitored:  8*time.Hour - time.Minute - 5*time.Minute,
+		},
+		{
+			name:         "reboot just before polling resumed",
+			observations: concat(upFor(0, time.Minute, -day), upFor(3*time.Hour, time.Minute, 3*time.Hour-2*time.Minute)),
+			until:        3*time.Hour + time.Minute,
+			outages:      []span{{start: 3*time.Hour - 2*time.Minute, end: 3 * time.Hour}},
+			monitored:    time.Minute + 2*time.Minute + time.Minute,
+			unmonitored:  3*time.Hour - time.Minute - 2*time.Minute,
+		},
+		{
+			name:         "gap without a reboot",
+			observations: concat(upFor(0, time.Minute, -day), upFor(6*time.Hour, time.Minute, -day)),
+			until:        6*time.Hour + time.Minute,
+			monitored:    2 * time.Minute,
+			unmonitored:  6*time.Hour - time.Minute,
+		},
+		{
+			name:         "down when the gap began, rebooted inside it",
+			observations: concat(upFor(0, time.Minute, -day), []outages.Observation{down(2 * time.Minute)}, upFor(7*time.Hour, time.Minute, 2*time.Hour)),
+			until:        7*time.Hour + time.Minute,
+			outages:      []span{{start: 2 * time.Minute, end: 2*time.Hour + 5*time.Minute}},
+			monitored:    2*time.Minute + (2*time.Hour + 5*time.Minute - 2*time.Minute) + time.Minute,
+			unmonitored:  7*time.Hour - 2*time.Minute - (2*time.Hour + 5*time.Minute - 2*time.Minute),
+		},
+		{
+			name:         "ongoing",
+			observations: concat(upFor(0, time.Minute, -day), []outages.Observation{down(2 * time.Minute), down(3 * time.Minute)}),
+			until:        5 * time.Minute,
+			outages:      []span{{start: 2 * time.Minute, end: 5 * time.Minute, ongoing: true}},
+			monitored:    5 * time.Minute,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			summary := outages.Analyze(tc.observations, nil, 2*time.Minute, start.Add(tc.until))
+
+			var got []span
+			var downtime time.Duration
+			for _, o := range summary.Outages {
+				got = append(got, span{start: o.Start.Sub(start), end: o.End.Sub(start), ongoing: o.Ongoing})
+				downtime += o.Duration()
+			}
+			if len(got) != len(tc.outages) {
+				t.Fatalf("outages = %+v, want %+v", got, tc.outages)
+			}
+			for i := range got {
+				if got[i] != tc.outages[i] {
+					t.Errorf("outage %d = %+v, want %+v", i, got[i], tc.outages[i])
+				}
+			}
+			if summary.Downtime != downtime {
+				t.Errorf("downtime = %s, want the sum of the outages, %s", summary.Downtime, downtime)
+			}
+			if summary.Monitored != tc.monitored || summary.Unmonitored != tc.unmonitored {
+				t.Errorf("monitored %s, unmonitored %s; want %s and %s", summary.Monitored, summary.Unmonitored, tc.monitored, tc.unmonitored)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/events"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+type RebootRecovery struct {
+	WentOffline    time.Duration
+	Answered       time.Duration
+	StartupDone    time.Duration
+	ChannelsLocked time.Duration
+}
+
+// Issue a reboot through the driver and block until the modem is back with every channel locked.
+func (c *Config) rebootAndTrack(timeout, pollInterval time.Duration) (*RebootRecovery, error) {
+	if c.ModemConfig.Client.Timeout == 0 || c.ModemConfig.Client.Timeout > pollInterval {
+		previousTimeout := c.ModemConfig.Client.Timeout
+		c.ModemConfig.Client.Timeout = pollInterval
+		defer func() { c.ModemConfig.Client.Timeout = previousTimeout }()
+	}
+
+	recovery := &RebootRecovery{}
+	start := time.Now()
+	deadline := start.Add(timeout)
+
+	if err := c.ModemConfig.Reboot(); err != nil {
+		return nil, err
+	}
+	c.emitEvent(c.newEvent(events.ModemRebooted, "reboot requested"))
+
+	logger.Println("Reboot requested, waiting for the modem to go offline...")
+	for {
+		if time.Now().After(deadline) {
+			return recovery, fmt.Errorf("modem did not go offline within %s", timeout)
+		}
+		connDetails, err := c.ModemConfig.GetConnectionDetails()
+		c.observeRecovery(connDetails)
+		if err != nil {
+			recovery.WentOffline = time.Since(start)
+			break
+		}
+		time.Sleep(pollInterval)
+	}
+
+	logger.Println("Modem offline, waiting for it to answer...")
+	for {
+		if time.Now().After(deadline) {
+			return recovery, fmt.Errorf("modem did not answer within %s", timeout)
+		}
+		if err := c.ModemConfig.Reauthenticate(); err == nil {
+			recovery.Answered = time.Since(start)
+			break
+		}
+		c.observeRecovery(nil)
+		time.Sleep(pollInterval)
+	}
+
+	logger.Println("Modem answered, waiting for startup sequence and channel lock...")
+	for {
+		if time.Now().After(deadline) {
+			return recovery, fmt.Errorf("modem did not recover within %s", timeout)
+		}
+		connDetails, err := c.ModemConfig.GetConnectionDetails()
+		c.observeRecovery(connDetails)
+		if err == nil {
+			if recovery.StartupDone == 0 && connDetails.StartupComplete() {
+				recovery.StartupDone = time.Since(start)
+			}
+			if recovery.StartupDone != 0 && connDetails.Downstream.AllLocked() && connDetails.Upstream.AllLocked() {
+				recovery.ChannelsLocked = time.Since(start)
+				// Later polls compare against the rebooted modem instead of reporting the reboot again.
+				c.LastConn, c.LastPoll = connDetails, c.now()
+				break
+			}
+		}
+		time.Sleep(pollInterval)
+	}
+
+	c.emitEvent(c.newEvent(events.ModemRecovered,
+		fmt.Sprintf("modem recovered after %s", recovery.ChannelsLocked.Round(time.Second))))
+	return recovery, nil
+}
+
+// The collector's polls wait while a remediation reboot is tracked, so the polls made here go
+// to the outage journal in their place. A nil connDetails records a failed poll. The reboot
+// command leaves the journal to the collector.
+func (c *Config) observeRecovery(connDetails *modem.Connection) {
+	if c.Scheduler != nil {
+		c.recordObservation(connDetails)
+	}
+}
+
+func printRebootRecovery(recovery *RebootRecovery) {
+	recoveryTable := table.NewWriter()
+	recoveryTable.SetTitle("REBOOT RECOVERY")
+	recoveryTable.SetStyle(table.StyleLight)
+	recoveryTable.Style().Title.Align = text.AlignCenter
+	recoveryTable.SetOutputMirror(os.Stdout)
+	recoveryTable.AppendHeader(table.Row{"Phase", "Elapsed"})
+	recoveryTable.AppendRows([]table.Row{
+		{"Went offline", recovery.WentOffline.Round(time.Second)},
+		{"Answered", recovery.Answered.Round(time.Second)},
+		{"Startup complete", recovery.StartupDone.Round(time.Second)},
+		{"All channels locked", recovery.ChannelsLocked.Round(time.Second)},
+	})
+	recoveryTable.Render()
+}
+
+// The modem is only logged in to once the flags say to go ahead.
+func runReboot(args []string) {
+	flags := flag.NewFlagSet("reboot", flag.ExitOnError)
+	confirm := flags.Bool("confirm", false, "actually reboot the modem")
+	timeout := flags.Duration("timeout", 10*time.Minute, "how long to wait for the modem to recover")
+	pollInterval := flags.Duration("poll", 5*time.Second, "how often to poll the modem while it recovers")
+	flags.Parse(args)
+
+	if !*confirm {
+		logger.Println("Refusing to reboot without --confirm")
+		os.Exit(1)
+	}
+
+	conf := setup()
+	recovery, err := conf.rebootAndTrack(*timeout, *pollInterval)
+	if recovery != nil {
+		printRebootRecovery(recovery)
+	}
+	if err != nil {
+		logger.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,216 @@
+package remediation
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ActionNone       = "none"
+	ActionReboot     = "reboot"
+	ActionDryRun     = "dry_run"
+	ActionSuppressed = "suppressed"
+)
+
+// Reasons of the audit lines RecordOutcome writes. They share the action of the decision, so
+// these tell them apart when the audit log is read back.
+const (
+	reasonCompleted = "reboot completed"
+	reasonFailed    = "reboot failed"
+)
+
+type Policy struct {
+	DryRun               bool
+	NoLockSustain        time.Duration
+	UncorrectableRate    float64 // uncorrectable codewords per minute
+	UncorrectableSustain time.Duration
+	Cooldown             time.Duration
+	MaxRebootsPerDay     int
+	AuditLogPath         string
+}
+
+// A single poll's worth of the values the policy conditions look at.
+type Observation struct {
+	Time             time.Time
+	LockedDownstream int
+	Uncorrected      float64
+}
+
+type Decision struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Condition string    `json:"condition,omitempty"`
+	Reason    string    `json:"reason"`
+}
+
+type condition struct {
+	name    string
+	sustain time.Duration
+	active  bool
+	since   time.Time
+}
+
+type Engine struct {
+	policy   Policy
+	noLock   *condition
+	climbing *condition
+	last     *Observation
+	reboots  []time.Time
+	// What the last decision was suppressed by, so that a suppression is audited once rather
+	// than on every poll it lasts. Empty when the last decision was not suppressed.
+	suppressed string
+	auditMutex sync.Mutex
+}
+
+// The reboots decided in the last 24 hours are read back from the audit log, so that the
+// cool-down and the daily cap hold across restarts.
+func NewEngine(policy Policy) *Engine {
+	e := &Engine{
+		policy:   policy,
+		noLock:   &condition{name: "no_locked_downstream", sustain: policy.NoLockSustain},
+		climbing: &condition{name: "uncorrectables_climbing", sustain: policy.UncorrectableSustain},
+	}
+	e.loadReboots()
+	e.pruneReboots(time.Now())
+	return e
+}
+
+// Evaluate the policy against a new observation. The returned decision is ActionReboot only when
+// a condition has held for its sustain window and neither the cool-down nor the daily cap apply.
+func (e *Engine) Evaluate(obs Observation) Decision {
+	e.update(e.noLock, obs.Time, obs.LockedDownstream == 0)
+
+	climbing := false
+	if e.last != nil && obs.Time.After(e.last.Time) && obs.Uncorrected >= e.last.Uncorrected {
+		perMinute := (obs.Uncorrected - e.last.Uncorrected) / obs.Time.Sub(e.last.Time).Minutes()
+		climbing = perMinute > e.policy.UncorrectableRate
+	}
+	e.update(e.climbing, obs.Time, climbing)
+	e.last = &obs
+
+	var triggered *condition
+	for _, c := range []*condition{e.noLock, e.climbing} {
+		if c.active && obs.Time.Sub(c.since) >= c.sustain {
+			triggered = c
+			break
+		}
+	}
+	if triggered == nil {
+		e.suppressed = ""
+		return Decision{Time: obs.Time, Action: ActionNone}
+	}
+
+	decision := Decision{
+		Time:      obs.Time,
+		Condition: triggered.name,
+		Reason:    fmt.Sprintf("%s sustained for %s", triggered.name, obs.Time.Sub(triggered.since).Round(time.Second)),
+	}
+	e.pruneReboots(obs.Time)
+	suppressed := ""
+	switch {
+	case len(e.reboots) > 0 && obs.Time.Sub(e.reboots[len(e.reboots)-1]) < e.policy.Cooldown:
+		decision.Action = ActionSuppressed
+		decision.Reason += fmt.Sprintf(", in cool-down until %s", e.reboots[len(e.reboots)-1].Add(e.policy.Cooldown).Format(time.RFC3339))
+		suppressed = triggered.name + " cool-down"
+	case e.policy.MaxRebootsPerDay > 0 && len(e.reboots) >= e.policy.MaxRebootsPerDay:
+		decision.Action = ActionSuppressed
+		decision.Reason += fmt.Sprintf(", daily cap of %d reboots reached", e.policy.MaxRebootsPerDay)
+		suppressed = triggered.name + " daily cap"
+	case e.policy.DryRun:
+		decision.Action = ActionDryRun
+		e.recordReboot(obs.Time)
+	default:
+		decision.Action = ActionReboot
+		e.recordReboot(obs.Time)
+	}
+	if suppressed == "" || suppressed != e.suppressed {
+		e.audit(decision)
+	}
+	e.suppressed = suppressed
+	return decision
+}
+
+// Record the outcome of a reboot that was issued because of a decision.
+func (e *Engine) RecordOutcome(decision Decision, err error) {
+	outcome := Decision{Time: time.Now().UTC(), Action: decision.Action, Condition: decision.Condition, Reason: reasonCompleted}
+	if err != nil {
+		outcome.Reason = fmt.Sprintf("%s: %v", reasonFailed, err)
+	}
+	e.audit(outcome)
+}
+
+func (e *Engine) update(c *condition, now time.Time, met bool) {
+	if met == c.active {
+		return
+	}
+	c.active = met
+	c.since = now
+	reason := "condition cleared"
+	if met {
+		reason = "condition started"
+	}
+	e.audit(Decision{Time: now, Action: ActionNone, Condition: c.name, Reason: reason})
+}
+
+func (e *Engine) recordReboot(t time.Time) {
+	e.reboots = append(e.reboots, t)
+	e.noLock.active, e.climbing.active = false, false
+	e.last = nil
+}
+
+func (e *Engine) pruneReboots(now time.Time) {
+	kept := e.reboots[:0]
+	for _, t := range e.reboots {
+		if now.Sub(t) < 24*time.Hour {
+			kept = append(kept, t)
+		}
+	}
+	e.reboots = kept
+}
+
+// Rebuild the reboot history from the decisions in the audit log. Reboots a dry run only
+// pretended to issue count towards another dry run, but never hold back a real reboot.
+func (e *Engine) loadReboots() {
+	if e.policy.AuditLogPath == "" {
+		return
+	}
+	f, err := os.Open(e.policy.AuditLogPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d Decision
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			continue
+		}
+		if d.Action != ActionReboot && !(e.policy.DryRun && d.Action == ActionDryRun) {
+			continue
+		}
+		if d.Reason == reasonCompleted || strings.HasPrefix(d.Reason, reasonFailed) {
+			continue
+		}
+		e.reboots = append(e.reboots, d.Time)
+	}
+}
+
+func (e *Engine) audit(d Decision) {
+	if e.policy.AuditLogPath == "" {
+		return
+	}
+	e.auditMutex.Lock()
+	defer e.auditMutex.Unlock()
+	f, err := os.OpenFile(e.policy.AuditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	line, _ := json.Marshal(d)
+	f.Write(append(line, '\n'))
+}
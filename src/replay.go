@@ -0,0 +1,211 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/alerts"
+	"github.com/RickyGrassmuck/modem_logs/archive"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/remediation"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+	"github.com/RickyGrassmuck/modem_logs/utils"
+)
+
+var replaySinks = []string{sinkInflux, sinkHistory, sinkLoki, sinkMQTT, sinkSyslog, sinkWeb, sinkJournal}
+
+// Prefixes every log line with the virtual time instead of the wall clock, so that replaying
+// the same recording prints the same output. Lines logged before the first response have no
+// time.
+type clockWriter struct {
+	now func() time.Time
+	out io.Writer
+}
+
+func (w *clockWriter) Write(p []byte) (int, error) {
+	prefix := ""
+	if now := w.now(); !now.IsZero() {
+		prefix = now.Local().Format("2006/01/02 15:04:05 ")
+	}
+	if _, err := fmt.Fprintf(w.out, "%s%s", prefix, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type replayStats struct {
+	Responses  int
+	Polls      int
+	LogEntries int
+	Failures   int
+}
+
+// Feeds archived responses through the collector pipeline in the order the collector fetched
+// them: device info, then connection info, then the log. A connection response is processed
+// once the log that followed it is known.
+type replayer struct {
+	conf      *Config
+	pending   *modem.Connection
+	pendingAt time.Time
+	stats     replayStats
+}
+
+func (r *replayer) flush() {
+	if r.pending == nil {
+		return
+	}
+	r.conf.processPoll(r.pending, r.pendingAt)
+	// Alert events go out in the background; wait for them so that the output stays in order.
+	r.conf.Alerts.Wait()
+	r.conf.remediate(r.pending)
+	r.pending = nil
+	r.stats.Polls++
+}
+
+func (r *replayer) replay(record archive.Record) error {
+	body := []byte(record.Body)
+	switch record.Action {
+	case modem.ActionDeviceInfo:
+		info, err := modem.ParseDeviceInfo(body)
+		if err != nil {
+			return err
+		}
+		r.flush()
+		r.conf.updateDeviceInfo(info)
+	case modem.ActionConnection:
+		connDetails, err := modem.ParseConnectionDetails(body)
+		if err != nil {
+			return err
+		}
+		r.flush()
+		r.pending, r.pendingAt = connDetails, record.Time.UTC()
+	case modem.ActionLogs:
+		logs, err := modem.ParseLogs(body)
+		if err != nil {
+			return err
+		}
+		r.stats.LogEntries += len(r.conf.processLogs(logs.Entries(), record.Time.UTC()))
+		r.flush()
+	}
+	return nil
+}
+
+func runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	archiveDir := flags.String("archive-dir", "", "archive directory (default $ARCHIVE_DIR)")
+	modemName := flags.String("modem", defaultModemName, "modem name the responses were archived under (default $MODEM_NAME)")
+	sinceFlag := flags.String("since", "7d", "start of the recording to replay, e.g. 7d or 2026-01-01")
+	untilFlag := flags.String("until", "", "end of the recording to replay (default now)")
+	speed := flags.Float64("speed", 0, "replay at this multiple of real time, e.g. 3600 for an hour per second (default as fast as possible)")
+	sinkFlag := flags.String("sink", "", fmt.Sprintf("comma-separated sinks to write to: %s (default none)", strings.Join(replaySinks, ", ")))
+	rulesFile := flags.String("rules", "", "alert rules file (default $ALERT_RULES_FILE or the built-in rules)")
+	withRemediation := flags.Bool("remediation", false, "evaluate the remediation policy from the environment; reboots are only reported")
+	flags.Parse(args)
+	if envDir, ok := os.LookupEnv("ARCHIVE_DIR"); ok && !flagWasSet(flags, "archive-dir") {
+		*archiveDir = envDir
+	}
+	if envModem, ok := os.LookupEnv("MODEM_NAME"); ok && !flagWasSet(flags, "modem") {
+		*modemName = envModem
+	}
+	if envRules, ok := os.LookupEnv("ALERT_RULES_FILE"); ok && !flagWasSet(flags, "rules") {
+		*rulesFile = envRules
+	}
+
+	// Sinks log from their own goroutines, so the clock is read concurrently.
+	var virtual time.Time
+	var clockValue atomic.Value
+	clockValue.Store(virtual)
+	clock := func() time.Time { return clockValue.Load().(time.Time) }
+	logger.SetFlags(0)
+	logger.SetOutput(&clockWriter{now: clock, out: os.Stdout})
+	defer func() {
+		logger.SetOutput(os.Stdout)
+		logger.SetFlags(log.LstdFlags)
+	}()
+
+	fail := func(err error) {
+		logger.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if *archiveDir == "" {
+		fail(fmt.Errorf("no archive directory; set --archive-dir or ARCHIVE_DIR"))
+	}
+	if *speed < 0 {
+		fail(fmt.Errorf("invalid speed %g", *speed))
+	}
+	now := time.Now().UTC()
+	since, err := utils.ParseSince(*sinceFlag, now)
+	if err != nil {
+		fail(err)
+	}
+	until := now
+	if *untilFlag != "" {
+		if until, err = utils.ParseSince(*untilFlag, now); err != nil {
+			fail(err)
+		}
+	}
+
+	conf := &Config{ModemName: *modemName, Now: clock}
+	conf.Thresholds, err = thresholds.Load(getEnvOrDefault("THRESHOLDS_PROFILE", "docsis"), os.Getenv("THRESHOLDS_FILE"))
+	if err != nil {
+		fail(err)
+	}
+	if _, err := conf.setupSinks(*sinkFlag, replaySinks); err != nil {
+		fail(err)
+	}
+	defer conf.Sinks.Close()
+	rules := alerts.DefaultRules
+	if *rulesFile != "" {
+		if rules, err = alerts.LoadRules(*rulesFile); err != nil {
+			fail(err)
+		}
+	}
+	// Without a state file every replay starts with no alerts active.
+	conf.Alerts, err = alerts.NewEngine(rules, "", &eventNotifier{conf: conf})
+	if err != nil {
+		fail(err)
+	}
+	if *withRemediation {
+		policy := remediationPolicy()
+		policy.DryRun, policy.AuditLogPath = true, ""
+		conf.Remediation = remediation.NewEngine(policy)
+	}
+
+	r := &replayer{conf: conf}
+	err = archive.Read(*archiveDir, *modemName, since, until, func(record archive.Record) error {
+		if *speed > 0 && !virtual.IsZero() && record.Time.After(virtual) {
+			time.Sleep(time.Duration(float64(record.Time.Sub(virtual)) / *speed))
+		}
+		if record.Time.After(virtual) {
+			virtual = record.Time
+			clockValue.Store(virtual)
+		}
+		r.stats.Responses++
+		if err := r.replay(record); err != nil {
+			r.stats.Failures++
+			logger.Printf("Skipping %s response from %s: %v\n", record.Action, record.Time.Format(time.RFC3339), err)
+		}
+		return nil
+	})
+	if err != nil {
+		fail(err)
+	}
+	r.flush()
+	conf.Sinks.Drain()
+	if len(conf.Sinks.Names()) > 0 {
+		conf.logSinkStats()
+	}
+
+	for _, alert := range conf.Alerts.Active() {
+		logger.Printf("Still %s at the end: %s (%s) since %s, value %s\n", alert.State, alert.Rule, alert.Severity,
+			alert.ActiveSince.Local().Format("2006-01-02 15:04:05"), alert.Value)
+	}
+	logger.Printf("Replayed %d polls, %d log entries and %d failures from %d responses\n",
+		r.stats.Polls, r.stats.LogEntries, r.stats.Failures, r.stats.Responses)
+}
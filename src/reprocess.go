@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/archive"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+	"github.com/RickyGrassmuck/modem_logs/utils"
+)
+
+var reprocessSinks = []string{sinkInflux, sinkHistory, sinkLoki}
+
+type reprocessStats struct {
+	Responses  int
+	Snapshots  int
+	LogEntries int
+	Failures   int
+}
+
+// Parse an archived response with the current parsers and write the results to the sinks,
+// timestamped with the time the response was received.
+func (c *Config) reprocessRecord(record archive.Record, stats *reprocessStats) error {
+	body := []byte(record.Body)
+	switch record.Action {
+	case modem.ActionDeviceInfo:
+		info, err := modem.ParseDeviceInfo(body)
+		if err != nil {
+			return err
+		}
+		c.DeviceInfo = info
+	case modem.ActionLogs:
+		logs, err := modem.ParseLogs(body)
+		if err != nil {
+			return err
+		}
+		c.LogEntries = logs.Entries()
+		c.NewEntries = c.newLogEntries(c.LogEntries)
+		c.Sinks.PublishLogEntries(&sinks.LogBatch{
+			Modem:      c.ModemName,
+			DeviceInfo: c.DeviceInfo,
+			Time:       record.Time.UTC(),
+			New:        c.NewEntries,
+			All:        c.LogEntries,
+		})
+		stats.LogEntries += len(c.NewEntries)
+	case modem.ActionConnection:
+		connDetails, err := modem.ParseConnectionDetails(body)
+		if err != nil {
+			return err
+		}
+		report := c.Thresholds.Evaluate(connDetails)
+		snap := &snapshot.Snapshot{
+			Time:       record.Time.UTC(),
+			Modem:      c.ModemName,
+			Connection: connDetails,
+			DeviceInfo: c.DeviceInfo,
+			Report:     report,
+			Health:     c.healthScore(connDetails, report, record.Time),
+		}
+		c.Sinks.PublishSnapshot(snap)
+		c.LastConn, c.LastPoll = connDetails, record.Time
+		stats.Snapshots++
+	}
+	return nil
+}
+
+func runReprocess(args []string) {
+	flags := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	from := flags.String("from", "archive", "source of the raw responses; only \"archive\" is supported")
+	archiveDir := flags.String("archive-dir", "", "archive directory (default $ARCHIVE_DIR)")
+	modemName := flags.String("modem", defaultModemName, "modem name the responses were archived under (default $MODEM_NAME)")
+	sinceFlag := flags.String("since", "30d", "start of the range to reprocess, e.g. 30d or 2026-01-01")
+	untilFlag := flags.String("until", "", "end of the range to reprocess (default now)")
+	sinkFlag := flags.String("sink", sinkInflux, fmt.Sprintf("comma-separated sinks to write to: %s", strings.Join(reprocessSinks, ", ")))
+	flags.Parse(args)
+	if envDir, ok := os.LookupEnv("ARCHIVE_DIR"); ok && !flagWasSet(flags, "archive-dir") {
+		*archiveDir = envDir
+	}
+	if envModem, ok := os.LookupEnv("MODEM_NAME"); ok && !flagWasSet(flags, "modem") {
+		*modemName = envModem
+	}
+
+	fail := func(err error) {
+		logger.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if *from != "archive" {
+		fail(fmt.Errorf("unsupported source %q", *from))
+	}
+	if *archiveDir == "" {
+		fail(fmt.Errorf("no archive directory; set --archive-dir or ARCHIVE_DIR"))
+	}
+	now := time.Now().UTC()
+	since, err := utils.ParseSince(*sinceFlag, now)
+	if err != nil {
+		fail(err)
+	}
+	until := now
+	if *untilFlag != "" {
+		if until, err = utils.ParseSince(*untilFlag, now); err != nil {
+			fail(err)
+		}
+	}
+
+	conf := &Config{ModemName: *modemName}
+	conf.Thresholds, err = thresholds.Load(getEnvOrDefault("THRESHOLDS_PROFILE", "docsis"), os.Getenv("THRESHOLDS_FILE"))
+	if err != nil {
+		fail(err)
+	}
+	enabled, err := conf.setupSinks(*sinkFlag, reprocessSinks)
+	if err != nil {
+		fail(err)
+	}
+	defer conf.Sinks.Close()
+
+	var stats reprocessStats
+	started := time.Now()
+	lastReport := started
+	report := func(at time.Time) {
+		elapsed := time.Since(started)
+		progress := 100 * at.Sub(since).Seconds() / until.Sub(since).Seconds()
+		logger.Printf("%s (%.1f%%): %d responses, %d snapshots, %d log entries, %d failures, %.0f responses/s\n",
+			at.Local().Format("2006-01-02 15:04"), progress, stats.Responses, stats.Snapshots, stats.LogEntries,
+			stats.Failures, float64(stats.Responses)/elapsed.Seconds())
+	}
+	err = archive.Read(*archiveDir, *modemName, since, until, func(record archive.Record) error {
+		stats.Responses++
+		if err := conf.reprocessRecord(record, &stats); err != nil {
+			stats.Failures++
+			logger.Printf("Skipping %s response from %s: %v\n", record.Action, record.Time.Format(time.RFC3339), err)
+		}
+		if time.Since(lastReport) >= 2*time.Second {
+			report(record.Time)
+			lastReport = time.Now()
+		}
+		return nil
+	})
+	if err != nil {
+		fail(err)
+	}
+	conf.Sinks.Drain()
+	report(until)
+	conf.logSinkStats()
+	if enabled[sinkHistory] {
+		// Old rows that were just written may already be due for rollup.
+		if err := conf.History.Maintain(now); err != nil {
+			logger.Printf("History maintenance failed: %v\n", err)
+		}
+	}
+	logger.Printf("Reprocessed %d responses in %s\n", stats.Responses, time.Since(started).Round(time.Millisecond))
+}
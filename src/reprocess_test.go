@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/archive"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/modem/mb8611/simulator"
+)
+
+// Archive a few polls of the simulator, with a reboot in between so that the log holds entries
+// from before the modem knew the time of day.
+func archivePolls(t *testing.T, dir string) {
+	t.Helper()
+	now := &clock{now: time.Now()}
+	config := simulator.DefaultConfig()
+	config.Now = now.Now
+	server := simulator.NewTestServer(config)
+	defer server.Close()
+
+	recorder, err := archive.New(archive.Config{Dir: dir, Modem: defaultModemName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := modem.NewClient(server.Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.Timeout = 5 * time.Second
+	client.Recorder = recorder
+	if _, err := client.Login(config.Username, config.Password); err != nil {
+		t.Fatal(err)
+	}
+	poll := func() {
+		t.Helper()
+		if _, err := client.GetDeviceInfo(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetConnectionDetails(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetLogs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	poll()
+	server.Simulator.Reboot()
+	now.Advance(config.RebootDowntime + config.LockDelay)
+	poll()
+	now.Advance(time.Minute)
+	poll()
+}
+
+func countRows(t *testing.T, path string) map[string]int {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	counts := map[string]int{}
+	for _, table := range []string{"snapshots", "channels", "log_entries"} {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		counts[table] = n
+	}
+	return counts
+}
+
+// Reprocessing the same range again has to leave the history database as it was.
+func TestReprocessTwice(t *testing.T) {
+	dir := t.TempDir()
+	archivePolls(t, filepath.Join(dir, "archive"))
+	dbPath := filepath.Join(dir, "history.db")
+	t.Setenv("HISTORY_DB", dbPath)
+	t.Setenv("MODEM_NAME", defaultModemName)
+	args := []string{"--archive-dir", filepath.Join(dir, "archive"), "--sink", sinkHistory, "--since", "1d"}
+
+	runReprocess(args)
+	first := countRows(t, dbPath)
+	if first["snapshots"] == 0 || first["channels"] == 0 || first["log_entries"] == 0 {
+		t.Fatalf("after the first run: %v, want snapshots with their channels and log entries", first)
+	}
+	var untimed int
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM log_entries WHERE time IS NULL").Scan(&untimed)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if untimed == 0 {
+		t.Fatal("no log entries without a time were stored")
+	}
+
+	runReprocess(args)
+	if second := countRows(t, dbPath); second["snapshots"] != first["snapshots"] ||
+		second["channels"] != first["channels"] || second["log_entries"] != first["log_entries"] {
+		t.Errorf("after the second run: %v, want %v", second, first)
+	}
+}
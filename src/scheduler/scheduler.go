@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Job struct {
+	Name string
+	// Runs are aligned to multiples of the interval, e.g. :00, :10, :20 for 10 seconds.
+	Interval time.Duration
+	// Each run is delayed by a random amount up to this, so that several collectors do not hit
+	// their modems or sinks in lockstep. It is capped at half the interval.
+	Jitter time.Duration
+	Run    func()
+}
+
+// The schedule of a single job.
+type Stats struct {
+	Name    string
+	Runs    int64
+	Missed  int64
+	LastRun time.Time
+	NextRun time.Time
+}
+
+type entry struct {
+	Job
+	next time.Time
+	// Set when the run was requested through RunNow rather than by the schedule.
+	onDemand bool
+	stats    Stats
+}
+
+// Runs jobs on their own intervals, one at a time and in the order they were given when
+// several are due together. When a run overruns or the process was suspended, the ticks that
+// were missed are skipped rather than run back to back.
+type Scheduler struct {
+	jobs    []*entry
+	trigger chan string
+	random  *rand.Rand
+	mutex   sync.Mutex
+	// Where skipped runs are reported. New sets it to log.Printf.
+	Logf func(format string, args ...interface{})
+}
+
+func New(jobs ...Job) (*Scheduler, error) {
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no jobs to schedule")
+	}
+	s := &Scheduler{
+		trigger: make(chan string, len(jobs)),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		Logf:    log.Printf,
+	}
+	for _, job := range jobs {
+		if job.Interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %s for %s", job.Interval, job.Name)
+		}
+		if job.Jitter > job.Interval/2 {
+			job.Jitter = job.Interval / 2
+		}
+		s.jobs = append(s.jobs, &entry{Job: job, stats: Stats{Name: job.Name}})
+	}
+	return s, nil
+}
+
+// The names of the jobs, in the order they were given.
+func (s *Scheduler) Names() []string {
+	var names []string
+	for _, e := range s.jobs {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// Run the named job as soon as the job running now, if any, is done. The schedule carries on
+// from there.
+func (s *Scheduler) RunNow(name string) error {
+	for _, e := range s.jobs {
+		if e.Name == name {
+			select {
+			case s.trigger <- name:
+			default:
+				// Enough requests are waiting that the job runs soon either way.
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown job %q", name)
+}
+
+func (s *Scheduler) Stats() []Stats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var stats []Stats
+	for _, e := range s.jobs {
+		stats = append(stats, e.stats)
+	}
+	return stats
+}
+
+// Run every job once, then each on its schedule until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	now := time.Now()
+	for _, e := range s.jobs {
+		e.next, e.onDemand = now, true
+	}
+	for {
+		next := s.jobs[0]
+		for _, e := range s.jobs[1:] {
+			if e.next.Before(next.next) {
+				next = e
+			}
+		}
+		timer := time.NewTimer(time.Until(next.next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case name := <-s.trigger:
+			timer.Stop()
+			for _, e := range s.jobs {
+				if e.Name == name {
+					e.next, e.onDemand = time.Now(), true
+				}
+			}
+			continue
+		case <-timer.C:
+		}
+		now := time.Now()
+		for _, e := range s.jobs {
+			if !e.next.After(now) {
+				s.run(e)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) run(e *entry) {
+	due := e.next
+	e.Run()
+	finished := time.Now()
+
+	// Ticks that passed while the job was late or running are skipped. On-demand runs are off
+	// the schedule, so they do not count.
+	missed := int64(0)
+	if !e.onDemand {
+		missed = int64(finished.Sub(due.Truncate(e.Interval)) / e.Interval)
+		if missed > 0 {
+			s.Logf("Skipped %d %s runs that were due while it was late or running\n", missed, e.Name)
+		}
+	}
+	e.next = finished.Truncate(e.Interval).Add(e.Interval)
+	if e.Jitter > 0 {
+		e.next = e.next.Add(time.Duration(s.random.Int63n(int64(e.Jitter))))
+	}
+	e.onDemand = false
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e.stats.Runs++
+	e.stats.Missed += missed
+	e.stats.LastRun, e.stats.NextRun = finished, e.next
+}
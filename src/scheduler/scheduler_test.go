@@ -0,0 +1,192 @@
+package scheduler_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/scheduler"
+)
+
+// Start the scheduler and return a function that stops it and waits for it to return.
+func start(t *testing.T, s *scheduler.Scheduler) func() {
+	t.Helper()
+	s.Logf = func(string, ...interface{}) {}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	stopped := false
+	stop := func() {
+		if !stopped {
+			stopped = true
+			cancel()
+			<-done
+		}
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func stats(s *scheduler.Scheduler, name string) scheduler.Stats {
+	for _, st := range s.Stats() {
+		if st.Name == name {
+			return st
+		}
+	}
+	return scheduler.Stats{}
+}
+
+func receive(t *testing.T, ch <-chan time.Time, what string) time.Time {
+	t.Helper()
+	select {
+	case at := <-ch:
+		return at
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+		return time.Time{}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := scheduler.New(); err == nil {
+		t.Error("no jobs: want an error")
+	}
+	if _, err := scheduler.New(scheduler.Job{Name: "stats", Run: func() {}}); err == nil {
+		t.Error("zero interval: want an error")
+	}
+	s, err := scheduler.New(scheduler.Job{Name: "stats", Interval: time.Second, Run: func() {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RunNow("logs"); err == nil {
+		t.Error("RunNow of an unknown job: want an error")
+	}
+}
+
+// After the first run, which starts right away, runs fall on multiples of the interval.
+func TestAlignment(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	runs := make(chan time.Time, 10)
+	s, err := scheduler.New(scheduler.Job{Name: "stats", Interval: interval, Run: func() { runs <- time.Now() }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := start(t, s)
+	receive(t, runs, "the first run")
+	for i := 0; i < 3; i++ {
+		at := receive(t, runs, "a scheduled run")
+		if late := at.Sub(at.Truncate(interval)); late > interval/4 {
+			t.Errorf("run at %s is %s past the tick", at.Format("15:04:05.000"), late)
+		}
+	}
+	stop()
+	st := stats(s, "stats")
+	if st.Runs < 4 || !st.NextRun.Equal(st.NextRun.Truncate(interval)) {
+		t.Errorf("stats %+v: want at least 4 runs and the next one on a tick", st)
+	}
+}
+
+// A scheduled run that overruns skips the ticks that passed, and counts them. The first run is
+// on demand, so its overrun does not count.
+func TestMissedTicks(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	runs := make(chan time.Time, 10)
+	s, err := scheduler.New(scheduler.Job{Name: "stats", Interval: interval, Run: func() {
+		time.Sleep(interval*2 + interval/2)
+		runs <- time.Now()
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := start(t, s)
+	receive(t, runs, "the first run")
+	first := receive(t, runs, "the second run")
+	stop()
+
+	st := stats(s, "stats")
+	if st.Runs != 2 || st.Missed != 2 {
+		t.Errorf("stats %+v: want 2 runs and 2 missed", st)
+	}
+	// The next run is the first tick after the overrun, not one of the skipped ones.
+	if want := first.Truncate(interval).Add(interval); st.NextRun.Before(want) || st.NextRun.Sub(want) > interval {
+		t.Errorf("next run %s, want the tick after %s", st.NextRun.Format("15:04:05.000"), first.Format("15:04:05.000"))
+	}
+}
+
+// Jitter longer than half the interval is cut down to half of it.
+func TestJitterCap(t *testing.T) {
+	const interval = 10 * time.Millisecond
+	var s *scheduler.Scheduler
+	var mutex sync.Mutex
+	var schedules []scheduler.Stats
+	runs := make(chan time.Time, 100)
+	s, err := scheduler.New(scheduler.Job{Name: "stats", Interval: interval, Jitter: time.Second, Run: func() {
+		// The stats still describe the run before this one.
+		mutex.Lock()
+		schedules = append(schedules, stats(s, "stats"))
+		mutex.Unlock()
+		runs <- time.Now()
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := start(t, s)
+	for i := 0; i < 20; i++ {
+		receive(t, runs, "a run")
+	}
+	stop()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, st := range schedules[1:] {
+		tick := st.LastRun.Truncate(interval).Add(interval)
+		if jitter := st.NextRun.Sub(tick); jitter < 0 || jitter >= interval/2 {
+			t.Errorf("run after %s was delayed by %s, want less than %s",
+				st.LastRun.Format("15:04:05.000"), jitter, interval/2)
+		}
+	}
+}
+
+// RunNow runs the job once more as soon as possible, without counting ticks as missed, and
+// leaves the other jobs on their schedule.
+func TestRunNow(t *testing.T) {
+	logs, stats := make(chan time.Time, 10), make(chan time.Time, 10)
+	s, err := scheduler.New(
+		scheduler.Job{Name: "logs", Interval: time.Hour, Run: func() { logs <- time.Now() }},
+		scheduler.Job{Name: "stats", Interval: time.Hour, Run: func() { stats <- time.Now() }},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := start(t, s)
+	receive(t, logs, "the first logs run")
+	receive(t, stats, "the first stats run")
+
+	requested := time.Now()
+	if err := s.RunNow("logs"); err != nil {
+		t.Fatal(err)
+	}
+	if at := receive(t, logs, "the requested logs run"); at.Sub(requested) > time.Second {
+		t.Errorf("requested run started %s after the request", at.Sub(requested))
+	}
+	select {
+	case <-stats:
+		t.Error("stats ran again without being requested")
+	case <-time.After(50 * time.Millisecond):
+	}
+	stop()
+
+	for _, st := range s.Stats() {
+		want := int64(1)
+		if st.Name == "logs" {
+			want = 2
+		}
+		if st.Runs != want || st.Missed != 0 {
+			t.Errorf("stats %+v: want %d runs and none missed", st, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+// Run the collector with the web dashboard enabled.
+func runServe(conf *Config, args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := flags.String("listen", ":8080", "address the dashboard listens on (default $SERVE_ADDRESS or :8080)")
+	flags.Parse(args)
+	conf.WebAddress = *listen
+	if envAddress, ok := os.LookupEnv("SERVE_ADDRESS"); ok && !flagWasSet(flags, "listen") {
+		conf.WebAddress = envAddress
+	}
+	runCollect(conf)
+}
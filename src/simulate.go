@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/RickyGrassmuck/modem_logs/modem/mb8611/simulator"
+)
+
+// Parse a comma-separated list of channel numbers, e.g. "3,7".
+func parseChannelList(value string) ([]int, error) {
+	var channels []int
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		channel, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel %q", field)
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+// Serve a simulated MB8611 so that the collector can be run without the hardware.
+func runSimulate(args []string) {
+	defaults := simulator.DefaultConfig()
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8443", "address to serve HNAP on")
+	plain := flags.Bool("plain", false, "serve plain HTTP instead of HTTPS")
+	config := defaults
+	flags.StringVar(&config.Username, "username", defaults.Username, "username the modem accepts")
+	flags.StringVar(&config.Password, "password", defaults.Password, "password the modem accepts")
+	flags.IntVar(&config.Downstream, "downstream", defaults.Downstream, "number of SC-QAM downstream channels")
+	flags.IntVar(&config.OFDM, "ofdm", defaults.OFDM, "number of OFDM downstream channels")
+	flags.IntVar(&config.Upstream, "upstream", defaults.Upstream, "number of SC-QAM upstream channels")
+	flags.IntVar(&config.OFDMA, "ofdma", defaults.OFDMA, "number of OFDMA upstream channels")
+	flags.Float64Var(&config.DownstreamPower, "power", defaults.DownstreamPower, "downstream power in dBmV")
+	flags.Float64Var(&config.DownstreamSNR, "snr", defaults.DownstreamSNR, "downstream SNR in dB")
+	flags.Float64Var(&config.UpstreamPower, "upstream-power", defaults.UpstreamPower, "upstream power in dBmV")
+	flags.Float64Var(&config.Noise, "noise", defaults.Noise, "standard deviation of the per-poll variation of power and SNR")
+	flags.Float64Var(&config.CorrectedPerMinute, "corrected", defaults.CorrectedPerMinute, "corrected codewords per channel and minute")
+	flags.Float64Var(&config.UncorrectedPerMinute, "uncorrected", defaults.UncorrectedPerMinute, "uncorrected codewords per channel and minute")
+	unlockedDownstream := flags.String("unlocked-downstream", "", "comma-separated downstream channels that report Not Locked")
+	unlockedUpstream := flags.String("unlocked-upstream", "", "comma-separated upstream channels that report Not Locked")
+	flags.DurationVar(&config.Uptime, "uptime", defaults.Uptime, "uptime reported at start")
+	flags.DurationVar(&config.RebootEvery, "reboot-every", 0, "reboot on a schedule (default never)")
+	flags.DurationVar(&config.RebootDowntime, "reboot-downtime", defaults.RebootDowntime, "how long the modem is unreachable after a reboot")
+	flags.DurationVar(&config.LockDelay, "lock-delay", defaults.LockDelay, "how long the modem takes to lock its channels once it answers again")
+	flags.Float64Var(&config.AuthErrorRate, "auth-error-rate", 0, "fraction of status requests that drop the session")
+	flags.Float64Var(&config.TimeoutRate, "timeout-rate", 0, "fraction of status requests that time out")
+	flags.Float64Var(&config.MalformedRate, "malformed-rate", 0, "fraction of status requests answered with truncated JSON")
+	flags.DurationVar(&config.Timeout, "timeout", defaults.Timeout, "how long a timed out request hangs")
+	flags.Float64Var(&config.LogEventsPerHour, "log-events", 0, "T3 time-outs and similar log entries per hour")
+	flags.Int64Var(&config.Seed, "seed", defaults.Seed, "seed for the simulated values and failures")
+	flags.Parse(args)
+
+	fail := func(err error) {
+		logger.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	var err error
+	if config.UnlockedDownstream, err = parseChannelList(*unlockedDownstream); err != nil {
+		fail(err)
+	}
+	if config.UnlockedUpstream, err = parseChannelList(*unlockedUpstream); err != nil {
+		fail(err)
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fail(err)
+	}
+	// httptest brings a self-signed certificate, like the one the modem serves.
+	server := httptest.NewUnstartedServer(simulator.New(config))
+	server.Listener.Close()
+	server.Listener = listener
+	if *plain {
+		server.Start()
+	} else {
+		server.StartTLS()
+	}
+
+	logger.Printf("Simulated MB8611 listening on %s\n", server.URL)
+	logger.Printf("Run the collector with MODEM_ADDRESS=%s/HNAP1/ MODEM_USERNAME=%s MODEM_PASSWORD=%s\n",
+		server.URL, config.Username, config.Password)
+	logger.Printf("Control it with POST %s/simulator/reboot, /simulator/fail?type=%s&count=N, /simulator/log and PUT /simulator/config\n",
+		server.URL, simulator.FailureTimeout)
+	select {}
+}
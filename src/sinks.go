@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+)
+
+const (
+	sinkInflux  = "influx"
+	sinkHistory = "history"
+	sinkLoki    = "loki"
+	sinkMQTT    = "mqtt"
+	sinkSyslog  = "syslog"
+	sinkWeb     = "web"
+	sinkJournal = "journal"
+)
+
+// The sinks in the order they are set up. The dashboard comes after the history store it
+// draws its charts from.
+var allSinks = []string{sinkInflux, sinkHistory, sinkLoki, sinkMQTT, sinkSyslog, sinkWeb}
+
+type sinkSetup struct {
+	// The variable that enables the sink.
+	env   string
+	setup func(c *Config) sinks.Sink
+}
+
+var sinkSetups = map[string]sinkSetup{
+	sinkInflux:  {"INFLUX_URL", (*Config).setupInflux},
+	sinkHistory: {"HISTORY_DB", (*Config).setupHistory},
+	sinkLoki:    {"LOKI_URL", (*Config).setupLoki},
+	sinkMQTT:    {"MQTT_BROKER", (*Config).setupMQTT},
+	sinkSyslog:  {"SYSLOG_ADDRESS", (*Config).setupSyslog},
+	sinkWeb:     {"SERVE_ADDRESS", (*Config).setupWeb},
+}
+
+// Set up every sink enabled in the environment and start dispatching to them. A sink that
+// falls behind has writes dropped rather than holding up the polls.
+func (c *Config) setupConfiguredSinks() {
+	var configured []sinks.Sink
+	for _, name := range allSinks {
+		if sink := sinkSetups[name].setup(c); sink != nil {
+			configured = append(configured, sink)
+		}
+	}
+	c.startSinks(configured, false)
+}
+
+// Set up the sinks in a comma-separated list of names, each of which has to be in allowed and
+// enabled in the environment, and start dispatching to them. Writes wait for a sink that falls
+// behind, so nothing is lost.
+func (c *Config) setupSinks(list string, allowed []string) (map[string]bool, error) {
+	requested := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, a := range allowed {
+			known = known || a == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown sink %q, expected one of %s", name, strings.Join(allowed, ", "))
+		}
+		requested[name] = true
+	}
+
+	var selected []sinks.Sink
+	for _, name := range allSinks {
+		if !requested[name] {
+			continue
+		}
+		setup := sinkSetups[name]
+		sink := setup.setup(c)
+		if sink == nil {
+			for _, s := range selected {
+				s.Close()
+			}
+			return nil, fmt.Errorf("the %s sink needs %s", name, setup.env)
+		}
+		selected = append(selected, sink)
+	}
+	// The outage journal is written directly rather than through the dispatcher, as failed polls
+	// go to it too.
+	if requested[sinkJournal] {
+		c.Journal = newJournal()
+	}
+	c.startSinks(selected, true)
+	return requested, nil
+}
+
+func (c *Config) startSinks(list []sinks.Sink, block bool) {
+	c.Sinks = sinks.NewDispatcher(sinks.Config{
+		QueueSize: getEnvIntOrDefault("SINK_QUEUE_SIZE", 100),
+		Block:     block,
+		Logf:      logger.Printf,
+	}, list...)
+	if len(list) > 0 {
+		logger.Printf("Writing to %s\n", strings.Join(c.Sinks.Names(), ", "))
+	}
+	if c.Web != nil {
+		if err := c.Web.Start(); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Printf("Serving dashboard on %s\n", c.WebAddress)
+	}
+}
+
+func (c *Config) sinkStats() []sinks.Stats {
+	return c.Sinks.Stats()
+}
+
+// Log the counters of every sink, e.g. at the end of a reprocess run.
+func (c *Config) logSinkStats() {
+	for _, s := range c.Sinks.Stats() {
+		line := fmt.Sprintf("Sink %s: %d written, %d failed, %d dropped", s.Name, s.Written, s.Failed, s.Dropped)
+		if s.LastError != "" {
+			line += fmt.Sprintf(", last error: %s", s.LastError)
+		}
+		logger.Println(line)
+	}
+}
@@ -0,0 +1,381 @@
+package influx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+	"github.com/shopspring/decimal"
+
+	"github.com/RickyGrassmuck/modem_logs/breaker"
+	"github.com/RickyGrassmuck/modem_logs/events"
+	"github.com/RickyGrassmuck/modem_logs/health"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+	"github.com/RickyGrassmuck/modem_logs/utils"
+)
+
+const writeTimeout = 30 * time.Second
+
+type Config struct {
+	URL    string
+	Token  string
+	Org    string
+	Bucket string
+	// When set, the counters of every sink are written as the "sink" measurement every
+	// StatsInterval (a minute by default) and once more on Close. They are timed by the clock
+	// rather than by snapshots, so they keep coming while the modem is unreachable.
+	Stats         func() []sinks.Stats
+	StatsInterval time.Duration
+	// When set, the state of the modem's circuit breaker is written as the "breaker" measurement
+	// with each snapshot and event, so that it is recorded when the circuit opens and closes.
+	Breaker func() breaker.Status
+}
+
+// Writes snapshots, events and log entries to an InfluxDB 2 bucket, creating the bucket on
+// the first write when it does not exist.
+type Writer struct {
+	config      Config
+	client      influxdb2.Client
+	writeAPI    api.WriteAPIBlocking
+	bucketReady bool
+	mutex       sync.Mutex
+	// The device info of the latest snapshot or log, used to tag events.
+	deviceInfo *modem.DeviceInfo
+	// Serializes writes, which come from the dispatcher and from the sink counter reporter.
+	writeMutex sync.Mutex
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+func New(config Config) *Writer {
+	if config.StatsInterval <= 0 {
+		config.StatsInterval = time.Minute
+	}
+	client := influxdb2.NewClient(config.URL, config.Token)
+	w := &Writer{
+		config:   config,
+		client:   client,
+		writeAPI: client.WriteAPIBlocking(config.Org, config.Bucket),
+		done:     make(chan struct{}),
+	}
+	if config.Stats != nil {
+		w.wg.Add(1)
+		go w.reportStats()
+	}
+	return w
+}
+
+func (w *Writer) Name() string { return "influx" }
+
+// Close writes the final sink counters and closes the client.
+func (w *Writer) Close() error {
+	close(w.done)
+	w.wg.Wait()
+	w.client.Close()
+	return nil
+}
+
+func (w *Writer) reportStats() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.config.StatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			w.writeStats()
+			return
+		}
+		w.writeStats()
+	}
+}
+
+// Failures only show in the log; the dispatcher counts the writes it hands out, not these.
+func (w *Writer) writeStats() {
+	at := time.Now().UTC()
+	info := w.getDeviceInfo()
+	var points []*write.Point
+	for _, s := range w.config.Stats() {
+		points = append(points, sinkPoint(s, info, at))
+	}
+	if err := w.write(points); err != nil {
+		log.Printf("Writing sink counters to InfluxDB failed: %v\n", err)
+	}
+}
+
+func (w *Writer) WriteSnapshot(snap *snapshot.Snapshot) error {
+	w.setDeviceInfo(snap.DeviceInfo)
+	at := snap.Time.UTC()
+	points := downstreamPoints(snap.Connection, snap.DeviceInfo, snap.Report, at)
+	points = append(points, upstreamPoints(snap.Connection, snap.DeviceInfo, snap.Report, at)...)
+	points = append(points, connectionPoint(snap.Connection, snap.DeviceInfo, at))
+	if snap.Health != nil {
+		points = append(points, healthPoint(snap.Health, snap.DeviceInfo, at))
+	}
+	if w.config.Breaker != nil {
+		points = append(points, breakerPoint(w.config.Breaker(), snap.DeviceInfo, at))
+	}
+	return w.write(points)
+}
+
+func (w *Writer) WriteEvent(e *events.Event) error {
+	p := influxdb2.NewPointWithMeasurement("events").
+		AddTag("modem", e.Modem).
+		AddTag("type", e.Type).
+		AddField("message", e.Message).
+		SetTime(e.Time)
+	for k, v := range e.Fields {
+		p.AddField(k, v)
+	}
+	info := w.getDeviceInfo()
+	points := []*write.Point{addDeviceTags(p, info)}
+	if w.config.Breaker != nil {
+		points = append(points, breakerPoint(w.config.Breaker(), info, e.Time))
+	}
+	return w.write(points)
+}
+
+// Write the new log entries. Entries without a timestamp are written at the time of the batch.
+func (w *Writer) WriteLogEntries(batch *sinks.LogBatch) error {
+	w.setDeviceInfo(batch.DeviceInfo)
+	if len(batch.New) == 0 {
+		return nil
+	}
+	var points []*write.Point
+	for _, entry := range batch.New {
+		timestamp := entry.Time
+		if timestamp.IsZero() {
+			timestamp = batch.Time
+		}
+		p := influxdb2.NewPointWithMeasurement("log_event").
+			AddTag("modem", batch.Modem).
+			AddTag("category", entry.Event.Category).
+			AddTag("severity", entry.Event.Severity).
+			AddTag("event_id", entry.Event.ID).
+			AddField("priority", entry.Priority).
+			AddField("message", entry.Message).
+			SetTime(timestamp.UTC())
+		points = append(points, addDeviceTags(p, batch.DeviceInfo))
+	}
+	return w.write(points)
+}
+
+func (w *Writer) setDeviceInfo(info *modem.DeviceInfo) {
+	if info == nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.deviceInfo = info
+}
+
+func (w *Writer) getDeviceInfo() *modem.DeviceInfo {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.deviceInfo
+}
+
+func (w *Writer) write(points []*write.Point) error {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	if !w.bucketReady {
+		if err := w.ensureBucket(ctx); err != nil {
+			return err
+		}
+		w.bucketReady = true
+	}
+	return w.writeAPI.WritePoint(ctx, points...)
+}
+
+// Make sure the bucket exists, creating it when it does not.
+func (w *Writer) ensureBucket(ctx context.Context) error {
+	bucketsAPI := w.client.BucketsAPI()
+	if _, err := bucketsAPI.FindBucketByName(ctx, w.config.Bucket); err == nil {
+		return nil
+	}
+	org, err := w.client.OrganizationsAPI().FindOrganizationByName(ctx, w.config.Org)
+	if err != nil {
+		return fmt.Errorf("finding organization %s: %w", w.config.Org, err)
+	}
+	if _, err := bucketsAPI.CreateBucketWithName(ctx, org, w.config.Bucket, domain.RetentionRule{EverySeconds: 0}); err != nil {
+		return fmt.Errorf("creating bucket %s: %w", w.config.Bucket, err)
+	}
+	return nil
+}
+
+func addDeviceTags(p *write.Point, info *modem.DeviceInfo) *write.Point {
+	if info == nil {
+		return p
+	}
+	for k, v := range info.Tags() {
+		p.AddTag(k, v)
+	}
+	return p
+}
+
+// Convert the downstream channels to points. The "downstream" measurement and its sum (101) and
+// power spread (102) aggregates only cover SC-QAM channels; OFDM channels go to "downstream_ofdm".
+func downstreamPoints(connDetails *modem.Connection, info *modem.DeviceInfo, report *thresholds.Report, influxTimeStamp time.Time) []*write.Point {
+
+	var points []*write.Point
+
+	channels := connDetails.DownstreamChannels()
+
+	powerLevels := []float64{}
+	totalCorrected := decimal.NewFromInt(0)
+	totalUncorrected := decimal.NewFromInt(0)
+
+	for _, channel := range channels.SCQAM {
+		power := decimal.NewFromFloat(channel.Power)
+		correctedErrors := decimal.NewFromInt(channel.Corrected)
+		uncorrectedErrors := decimal.NewFromInt(channel.Uncorrected)
+
+		verdict := report.DownstreamVerdict(channel.Channel)
+		p := influxdb2.NewPointWithMeasurement("downstream").
+			AddTag("id", strconv.Itoa(channel.Channel)).
+			AddField("power", power).
+			AddField("snr", decimal.NewFromFloat(channel.SNR)).
+			AddField("corrected_errors", correctedErrors).
+			AddField("uncorrected_errors", uncorrectedErrors).
+			AddField("verdict", string(verdict)).
+			SetTime(influxTimeStamp)
+		addDeviceTags(p, info)
+
+		totalCorrected = totalCorrected.Add(correctedErrors)
+		totalUncorrected = totalUncorrected.Add(uncorrectedErrors)
+		powerLevels = append(powerLevels, channel.Power)
+		points = append(points, p)
+	}
+
+	for _, channel := range channels.OFDM {
+		verdict := report.DownstreamVerdict(channel.Channel)
+		p := influxdb2.NewPointWithMeasurement("downstream_ofdm").
+			AddTag("id", strconv.Itoa(channel.Channel)).
+			AddTag("channel_id", strconv.Itoa(channel.ChannelID)).
+			AddField("plc_frequency", decimal.NewFromFloat(channel.PLCFrequency)).
+			AddField("power", decimal.NewFromFloat(channel.Power)).
+			AddField("mer", decimal.NewFromFloat(channel.MER)).
+			AddField("corrected_errors", decimal.NewFromInt(channel.Corrected)).
+			AddField("uncorrected_errors", decimal.NewFromInt(channel.Uncorrected)).
+			AddField("verdict", string(verdict)).
+			SetTime(influxTimeStamp)
+		addDeviceTags(p, info)
+		points = append(points, p)
+	}
+
+	sumPoint := influxdb2.NewPointWithMeasurement("downstream").
+		AddTag("id", "101").
+		AddField("power", decimal.NewFromFloat(0.0)).
+		AddField("snr", decimal.NewFromFloat(0.0)).
+		AddField("corrected_errors", totalCorrected).
+		AddField("uncorrected_errors", totalUncorrected).
+		SetTime(influxTimeStamp)
+	addDeviceTags(sumPoint, info)
+	points = append(points, sumPoint)
+
+	if len(powerLevels) == 0 {
+		return points
+	}
+
+	powerSpreadPoint := influxdb2.NewPointWithMeasurement("downstream").
+		AddTag("id", "102").
+		AddField("power", decimal.NewFromFloat(utils.CalculateSpread(powerLevels)).Round(1)).
+		AddField("snr", decimal.NewFromFloat(0.0)).
+		AddField("corrected_errors", decimal.NewFromFloat(0.0)).
+		AddField("uncorrected_errors", decimal.NewFromFloat(0.0)).
+		SetTime(influxTimeStamp)
+	addDeviceTags(powerSpreadPoint, info)
+
+	points = append(points, powerSpreadPoint)
+
+	return points
+}
+
+func upstreamPoints(connDetails *modem.Connection, info *modem.DeviceInfo, report *thresholds.Report, influxTimeStamp time.Time) []*write.Point {
+	var points []*write.Point
+
+	channels := connDetails.UpstreamChannels()
+
+	for _, channel := range channels.SCQAM {
+		verdict := report.UpstreamVerdict(channel.Channel)
+		p := influxdb2.NewPointWithMeasurement("upstream").
+			AddTag("id", strconv.Itoa(channel.Channel)).
+			AddField("symbol_rate", channel.SymbolRate).
+			AddField("frequency", decimal.NewFromFloat(channel.Frequency)).
+			AddField("power", decimal.NewFromFloat(channel.Power)).
+			AddField("verdict", string(verdict)).
+			SetTime(influxTimeStamp)
+		addDeviceTags(p, info)
+		points = append(points, p)
+	}
+
+	for _, channel := range channels.OFDMA {
+		verdict := report.UpstreamVerdict(channel.Channel)
+		p := influxdb2.NewPointWithMeasurement("upstream_ofdma").
+			AddTag("id", strconv.Itoa(channel.Channel)).
+			AddTag("channel_id", strconv.Itoa(channel.ChannelID)).
+			AddField("frequency", decimal.NewFromFloat(channel.Frequency)).
+			AddField("power", decimal.NewFromFloat(channel.Power)).
+			AddField("verdict", string(verdict)).
+			SetTime(influxTimeStamp)
+		addDeviceTags(p, info)
+		points = append(points, p)
+	}
+
+	return points
+}
+
+func connectionPoint(connDetails *modem.Connection, info *modem.DeviceInfo, at time.Time) *write.Point {
+	p := influxdb2.NewPointWithMeasurement("connection").
+		AddField("connectivity", connDetails.ConnectivityStatus).
+		AddField("uptime", connDetails.Uptime).
+		AddField("lag_status", connDetails.LagStatus).
+		SetTime(at)
+	return addDeviceTags(p, info)
+}
+
+func healthPoint(score *health.Score, info *modem.DeviceInfo, at time.Time) *write.Point {
+	p := influxdb2.NewPointWithMeasurement("health").
+		AddField("score", score.Value).
+		SetTime(at)
+	for _, name := range health.FactorNames {
+		p.AddField("penalty_"+name, score.Penalty(name))
+	}
+	return addDeviceTags(p, info)
+}
+
+func sinkPoint(s sinks.Stats, info *modem.DeviceInfo, at time.Time) *write.Point {
+	p := influxdb2.NewPointWithMeasurement("sink").
+		AddTag("sink", s.Name).
+		AddField("written", s.Written).
+		AddField("failed", s.Failed).
+		AddField("dropped", s.Dropped).
+		AddField("queued", s.Queued).
+		SetTime(at)
+	return addDeviceTags(p, info)
+}
+
+func breakerPoint(status breaker.Status, info *modem.DeviceInfo, at time.Time) *write.Point {
+	reachable := 1
+	if status.State == breaker.Open {
+		reachable = 0
+	}
+	p := influxdb2.NewPointWithMeasurement("breaker").
+		AddField("state", string(status.State)).
+		AddField("reachable", reachable).
+		AddField("failures", status.Failures).
+		SetTime(at)
+	return addDeviceTags(p, info)
+}
@@ -0,0 +1,227 @@
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+)
+
+type Config struct {
+	URL           string
+	TenantID      string
+	Username      string
+	Password      string
+	BatchSize     int
+	BatchInterval time.Duration
+	MaxRetries    int
+	ModemName     string
+}
+
+// Pushes modem log entries to the Loki push API. Entries are buffered and sent when the
+// batch is full or the batch interval elapses; failed pushes are retried with backoff.
+type Pusher struct {
+	sinks.Base
+	config  Config
+	client  *http.Client
+	mutex   sync.Mutex
+	pending []modem.LogEntry
+	flush   chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func New(config Config) *Pusher {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.BatchInterval <= 0 {
+		config.BatchInterval = 5 * time.Second
+	}
+	p := &Pusher{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+		flush:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+func (p *Pusher) Push(entries []modem.LogEntry) {
+	p.mutex.Lock()
+	p.pending = append(p.pending, entries...)
+	full := len(p.pending) >= p.config.BatchSize
+	p.mutex.Unlock()
+	if full {
+		select {
+		case p.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *Pusher) Name() string { return "loki" }
+
+// Buffer the new entries. Pushing happens in the background, so failures only show in the log.
+func (p *Pusher) WriteLogEntries(batch *sinks.LogBatch) error {
+	if len(batch.New) > 0 {
+		p.Push(batch.New)
+	}
+	return nil
+}
+
+// Close sends whatever is still buffered and stops the background sender.
+func (p *Pusher) Close() error {
+	close(p.done)
+	p.wg.Wait()
+	return nil
+}
+
+func (p *Pusher) run() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.config.BatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.flush:
+		case <-p.done:
+			p.send()
+			return
+		}
+		p.send()
+	}
+}
+
+func (p *Pusher) send() {
+	for {
+		p.mutex.Lock()
+		if len(p.pending) == 0 {
+			p.mutex.Unlock()
+			return
+		}
+		n := len(p.pending)
+		if n > p.config.BatchSize {
+			n = p.config.BatchSize
+		}
+		batch := append([]modem.LogEntry{}, p.pending[:n]...)
+		p.pending = p.pending[n:]
+		p.mutex.Unlock()
+
+		if err := p.pushWithRetry(batch); err != nil {
+			log.Printf("Pushing %d entries to Loki failed: %v\n", len(batch), err)
+			return
+		}
+	}
+}
+
+func (p *Pusher) pushWithRetry(batch []modem.LogEntry) error {
+	body, err := json.Marshal(p.buildRequest(batch))
+	if err != nil {
+		return err
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := p.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= p.config.MaxRetries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-p.done:
+			// Shutting down: make one last attempt without waiting.
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// Returns whether a failed request is worth retrying.
+func (p *Pusher) post(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", strings.TrimSuffix(p.config.URL, "/")+"/loki/api/v1/push", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", p.config.TenantID)
+	}
+	if p.config.Username != "" {
+		req.SetBasicAuth(p.config.Username, p.config.Password)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("loki returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type pushRequest struct {
+	Streams []*stream `json:"streams"`
+}
+
+// Group the entries into streams by label set. Entries without a modem timestamp use the time
+// they were collected.
+func (p *Pusher) buildRequest(batch []modem.LogEntry) pushRequest {
+	streams := map[string]*stream{}
+	var order []string
+	now := time.Now()
+	for _, entry := range batch {
+		labels := map[string]string{
+			"job":      "modem_stats",
+			"modem":    p.config.ModemName,
+			"priority": strconv.Itoa(entry.Priority),
+			"category": entry.Event.Category,
+		}
+		key := labels["priority"] + "|" + labels["category"]
+		s, ok := streams[key]
+		if !ok {
+			s = &stream{Stream: labels}
+			streams[key] = s
+			order = append(order, key)
+		}
+		timestamp := entry.Time
+		if timestamp.IsZero() {
+			timestamp = now
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(timestamp.UnixNano(), 10), entry.Message})
+	}
+	var request pushRequest
+	for _, key := range order {
+		s := streams[key]
+		sort.SliceStable(s.Values, func(i, j int) bool {
+			a, _ := strconv.ParseInt(s.Values[i][0], 10, 64)
+			b, _ := strconv.ParseInt(s.Values[j][0], 10, 64)
+			return a < b
+		})
+		request.Streams = append(request.Streams, s)
+	}
+	return request
+}
@@ -0,0 +1,313 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+)
+
+type Config struct {
+	Broker          string
+	ClientID        string
+	Username        string
+	Password        string
+	TopicPrefix     string
+	DiscoveryPrefix string
+	Retain          bool
+	QoS             byte
+	ModemName       string
+}
+
+// Publishes snapshots to MQTT. A retained "online"/"offline" message on the availability
+// topic tracks the connection, with "offline" registered as the last will.
+type Publisher struct {
+	sinks.Base
+	config     Config
+	client     paho.Client
+	mutex      sync.Mutex
+	discovered map[string]bool
+}
+
+func New(config Config) (*Publisher, error) {
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = "modem_stats/" + config.ModemName
+	}
+	p := &Publisher{config: config, discovered: map[string]bool{}}
+
+	opts := paho.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetWill(p.availabilityTopic(), "offline", config.QoS, true).
+		SetOnConnectHandler(func(client paho.Client) {
+			client.Publish(p.availabilityTopic(), config.QoS, true, "online")
+			// The broker may have lost retained discovery configs, so send them again.
+			p.mutex.Lock()
+			p.discovered = map[string]bool{}
+			p.mutex.Unlock()
+		})
+	p.client = paho.NewClient(opts)
+	token := p.client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		return nil, fmt.Errorf("timed out connecting to MQTT broker %s", config.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Publisher) Name() string { return "mqtt" }
+
+func (p *Publisher) WriteSnapshot(snap *snapshot.Snapshot) error {
+	return p.PublishSnapshot(snap)
+}
+
+func (p *Publisher) Close() error {
+	p.publish(p.availabilityTopic(), true, "offline")
+	p.client.Disconnect(250)
+	return nil
+}
+
+func (p *Publisher) availabilityTopic() string {
+	return p.config.TopicPrefix + "/availability"
+}
+
+type stateMessage struct {
+	Time             time.Time `json:"time"`
+	Connectivity     string    `json:"connectivity"`
+	Uptime           string    `json:"uptime"`
+	UptimeSeconds    float64   `json:"uptime_seconds"`
+	LagStatus        string    `json:"lag_status"`
+	HealthScore      float64   `json:"health_score"`
+	LockedDownstream int       `json:"locked_downstream"`
+	TotalDownstream  int       `json:"total_downstream"`
+	LockedUpstream   int       `json:"locked_upstream"`
+	TotalUpstream    int       `json:"total_upstream"`
+	TotalCorrected   int64     `json:"corrected_total"`
+	TotalUncorrected int64     `json:"uncorrected_total"`
+	PowerSpread      float64   `json:"power_spread"`
+	SoftwareVersion  string    `json:"sw_version,omitempty"`
+}
+
+type channelMessage struct {
+	Type        modem.ChannelType `json:"type"`
+	LockStatus  string            `json:"lock_status"`
+	Frequency   float64           `json:"frequency"`
+	Power       float64           `json:"power"`
+	SNR         float64           `json:"snr"`
+	Corrected   int64             `json:"corrected"`
+	Uncorrected int64             `json:"uncorrected"`
+	Verdict     string            `json:"verdict,omitempty"`
+}
+
+func (p *Publisher) PublishSnapshot(snap *snapshot.Snapshot) error {
+	agg := snap.Aggregates()
+	state := stateMessage{
+		Time:             snap.Time,
+		Connectivity:     snap.Connection.ConnectivityStatus,
+		Uptime:           snap.Connection.Uptime,
+		UptimeSeconds:    snap.Connection.UptimeDuration().Seconds(),
+		LagStatus:        snap.Connection.LagStatus,
+		LockedDownstream: agg.LockedDownstream,
+		TotalDownstream:  agg.TotalDownstream,
+		LockedUpstream:   agg.LockedUpstream,
+		TotalUpstream:    agg.TotalUpstream,
+		TotalCorrected:   agg.TotalCorrected,
+		TotalUncorrected: agg.TotalUncorrected,
+		PowerSpread:      agg.PowerSpread,
+	}
+	if snap.Health != nil {
+		state.HealthScore = snap.Health.Value
+	}
+	if snap.DeviceInfo != nil {
+		state.SoftwareVersion = snap.DeviceInfo.SoftwareVersion
+	}
+
+	channels := map[string]channelMessage{}
+	downstream := snap.Connection.DownstreamChannels()
+	for _, c := range downstream.SCQAM {
+		channels[fmt.Sprintf("downstream/%d", c.Channel)] = channelMessage{
+			Type: modem.ChannelSCQAM, LockStatus: c.LockStatus, Frequency: c.Frequency, Power: c.Power,
+			SNR: c.SNR, Corrected: c.Corrected, Uncorrected: c.Uncorrected, Verdict: verdict(snap, "downstream", c.Channel),
+		}
+	}
+	for _, c := range downstream.OFDM {
+		channels[fmt.Sprintf("downstream/%d", c.Channel)] = channelMessage{
+			Type: modem.ChannelOFDM, LockStatus: c.LockStatus, Frequency: c.PLCFrequency, Power: c.Power,
+			SNR: c.MER, Corrected: c.Corrected, Uncorrected: c.Uncorrected, Verdict: verdict(snap, "downstream", c.Channel),
+		}
+	}
+	upstream := snap.Connection.UpstreamChannels()
+	for _, c := range upstream.SCQAM {
+		channels[fmt.Sprintf("upstream/%d", c.Channel)] = channelMessage{
+			Type: modem.ChannelSCQAM, LockStatus: c.LockStatus, Frequency: c.Frequency, Power: c.Power,
+			Verdict: verdict(snap, "upstream", c.Channel),
+		}
+	}
+	for _, c := range upstream.OFDMA {
+		channels[fmt.Sprintf("upstream/%d", c.Channel)] = channelMessage{
+			Type: modem.ChannelOFDMA, LockStatus: c.LockStatus, Frequency: c.Frequency, Power: c.Power,
+			Verdict: verdict(snap, "upstream", c.Channel),
+		}
+	}
+
+	if p.config.DiscoveryPrefix != "" {
+		if err := p.publishDiscovery(snap, channels); err != nil {
+			return err
+		}
+	}
+	if err := p.publishJSON(p.config.TopicPrefix+"/state", state); err != nil {
+		return err
+	}
+	for suffix, message := range channels {
+		if err := p.publishJSON(p.config.TopicPrefix+"/"+suffix, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verdict(snap *snapshot.Snapshot, direction string, channel int) string {
+	if snap.Report == nil {
+		return ""
+	}
+	if direction == "upstream" {
+		return string(snap.Report.UpstreamVerdict(channel))
+	}
+	return string(snap.Report.DownstreamVerdict(channel))
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+	HWVersion    string   `json:"hw_version,omitempty"`
+}
+
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	Icon              string          `json:"icon,omitempty"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	Device            discoveryDevice `json:"device"`
+}
+
+type sensorSpec struct {
+	id, name, topic, field, unit, deviceClass, stateClass, icon string
+}
+
+// Publish Home Assistant MQTT discovery configs for the aggregate sensors and for every channel
+// not announced yet. Configs are retained so Home Assistant picks them up after a restart.
+func (p *Publisher) publishDiscovery(snap *snapshot.Snapshot, channels map[string]channelMessage) error {
+	node := sanitize(p.config.ModemName)
+	device := discoveryDevice{
+		Identifiers:  []string{node},
+		Name:         p.config.ModemName,
+		Manufacturer: "Motorola",
+		Model:        "MB8611",
+	}
+	if snap.DeviceInfo != nil {
+		if snap.DeviceInfo.SerialNumber != "" {
+			device.Identifiers = append(device.Identifiers, snap.DeviceInfo.SerialNumber)
+		}
+		device.SWVersion = snap.DeviceInfo.SoftwareVersion
+		device.HWVersion = snap.DeviceInfo.HardwareVersion
+	}
+
+	stateTopic := p.config.TopicPrefix + "/state"
+	specs := []sensorSpec{
+		{"connectivity", "Connectivity", stateTopic, "connectivity", "", "", "", "mdi:lan-connect"},
+		{"uptime", "Uptime", stateTopic, "uptime_seconds", "s", "duration", "measurement", ""},
+		{"lag_status", "Link Aggregation", stateTopic, "lag_status", "", "", "", "mdi:ethernet"},
+		{"health_score", "Health Score", stateTopic, "health_score", "%", "", "measurement", "mdi:heart-pulse"},
+		{"locked_downstream", "Locked Downstream Channels", stateTopic, "locked_downstream", "", "", "measurement", "mdi:lock"},
+		{"locked_upstream", "Locked Upstream Channels", stateTopic, "locked_upstream", "", "", "measurement", "mdi:lock"},
+		{"corrected_total", "Corrected Codewords", stateTopic, "corrected_total", "", "", "total_increasing", "mdi:check-circle"},
+		{"uncorrected_total", "Uncorrectable Codewords", stateTopic, "uncorrected_total", "", "", "total_increasing", "mdi:alert-circle"},
+		{"power_spread", "Downstream Power Spread", stateTopic, "power_spread", "dB", "", "measurement", "mdi:chart-bell-curve"},
+		{"sw_version", "Firmware", stateTopic, "sw_version", "", "", "", "mdi:chip"},
+	}
+	for suffix := range channels {
+		direction, channel, _ := strings.Cut(suffix, "/")
+		topic := p.config.TopicPrefix + "/" + suffix
+		label := strings.ToUpper(direction[:1]) + direction[1:] + " " + channel
+		id := direction + "_" + channel
+		specs = append(specs, sensorSpec{id + "_power", label + " Power", topic, "power", "dBmV", "", "measurement", "mdi:signal"})
+		if direction == "downstream" {
+			specs = append(specs, sensorSpec{id + "_snr", label + " SNR", topic, "snr", "dB", "", "measurement", "mdi:signal-variant"})
+		}
+	}
+
+	for _, spec := range specs {
+		p.mutex.Lock()
+		done := p.discovered[spec.id]
+		p.mutex.Unlock()
+		if done {
+			continue
+		}
+		config := discoveryConfig{
+			Name:              spec.name,
+			UniqueID:          node + "_" + spec.id,
+			StateTopic:        spec.topic,
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", spec.field),
+			UnitOfMeasurement: spec.unit,
+			DeviceClass:       spec.deviceClass,
+			StateClass:        spec.stateClass,
+			Icon:              spec.icon,
+			AvailabilityTopic: p.availabilityTopic(),
+			Device:            device,
+		}
+		topic := fmt.Sprintf("%s/sensor/%s/%s/config", p.config.DiscoveryPrefix, node, spec.id)
+		payload, _ := json.Marshal(config)
+		if err := p.publish(topic, true, payload); err != nil {
+			return err
+		}
+		p.mutex.Lock()
+		p.discovered[spec.id] = true
+		p.mutex.Unlock()
+	}
+	return nil
+}
+
+func (p *Publisher) publishJSON(topic string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.publish(topic, p.config.Retain, payload)
+}
+
+func (p *Publisher) publish(topic string, retain bool, payload interface{}) error {
+	token := p.client.Publish(topic, p.config.QoS, retain, payload)
+	if !token.WaitTimeout(5 * time.Second) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
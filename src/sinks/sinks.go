@@ -0,0 +1,289 @@
+package sinks
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/events"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+)
+
+// A destination for what the collector produces. The dispatcher calls the methods of a sink
+// from a single goroutine, in the order the collector published, so a sink only has to guard
+// state it shares with other goroutines.
+type Sink interface {
+	Name() string
+	WriteSnapshot(snap *snapshot.Snapshot) error
+	WriteEvent(e *events.Event) error
+	WriteLogEntries(batch *LogBatch) error
+	Close() error
+}
+
+// The modem log as fetched by one poll.
+type LogBatch struct {
+	Modem      string
+	DeviceInfo *modem.DeviceInfo
+	// When the log was fetched. Entries without a timestamp of their own are written at this time.
+	Time time.Time
+	// Entries that were not in the previous poll's log.
+	New []modem.LogEntry
+	// The whole log, oldest entry first.
+	All []modem.LogEntry
+}
+
+// Ignores everything. Sinks embed it and override the writes they handle.
+type Base struct{}
+
+func (Base) WriteSnapshot(*snapshot.Snapshot) error { return nil }
+func (Base) WriteEvent(*events.Event) error         { return nil }
+func (Base) WriteLogEntries(*LogBatch) error        { return nil }
+func (Base) Close() error                           { return nil }
+
+// Counters of a single sink since the dispatcher started.
+type Stats struct {
+	Name          string
+	Written       int64
+	Failed        int64
+	Dropped       int64
+	Queued        int
+	LastError     string
+	LastErrorTime time.Time
+}
+
+type Config struct {
+	// Writes each sink can fall behind by before further writes to it are dropped.
+	QueueSize int
+	// Wait for room in a full queue instead of dropping. Reprocessing and replays would rather
+	// be slow than lose data.
+	Block bool
+	// How long Close waits for the queues to drain.
+	CloseTimeout time.Duration
+	// Where failures and dropped writes are reported; log.Printf when nil.
+	Logf func(format string, args ...interface{})
+}
+
+type item struct {
+	snapshot *snapshot.Snapshot
+	event    *events.Event
+	logs     *LogBatch
+}
+
+const (
+	kindSnapshot = iota
+	kindEvent
+	kindLogs
+)
+
+func (it item) kind() int {
+	switch {
+	case it.snapshot != nil:
+		return kindSnapshot
+	case it.event != nil:
+		return kindEvent
+	default:
+		return kindLogs
+	}
+}
+
+type worker struct {
+	sink     Sink
+	queue    chan item
+	pending  sync.WaitGroup
+	done     chan struct{}
+	mutex    sync.Mutex
+	stats    Stats
+	dropping bool
+	// Whether the last write of each kind failed. Kinds are tracked apart because a sink may
+	// have nothing to do for one of them, which says nothing about whether it has recovered.
+	failing [3]bool
+}
+
+// Fans writes out to several sinks. Every sink has its own queue and goroutine, so a sink that
+// is slow or failing holds up neither the collector nor the other sinks. A nil dispatcher
+// discards everything.
+type Dispatcher struct {
+	config  Config
+	workers []*worker
+}
+
+func NewDispatcher(config Config, sinks ...Sink) *Dispatcher {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.CloseTimeout <= 0 {
+		config.CloseTimeout = 10 * time.Second
+	}
+	if config.Logf == nil {
+		config.Logf = log.Printf
+	}
+	d := &Dispatcher{config: config}
+	for _, sink := range sinks {
+		w := &worker{
+			sink:  sink,
+			queue: make(chan item, config.QueueSize),
+			done:  make(chan struct{}),
+			stats: Stats{Name: sink.Name()},
+		}
+		d.workers = append(d.workers, w)
+		go d.run(w)
+	}
+	return d
+}
+
+// The names of the sinks, in the order they were given.
+func (d *Dispatcher) Names() []string {
+	if d == nil {
+		return nil
+	}
+	var names []string
+	for _, w := range d.workers {
+		names = append(names, w.stats.Name)
+	}
+	return names
+}
+
+func (d *Dispatcher) PublishSnapshot(snap *snapshot.Snapshot) {
+	d.publish(item{snapshot: snap})
+}
+
+func (d *Dispatcher) PublishEvent(e *events.Event) {
+	d.publish(item{event: e})
+}
+
+func (d *Dispatcher) PublishLogEntries(batch *LogBatch) {
+	d.publish(item{logs: batch})
+}
+
+func (d *Dispatcher) publish(it item) {
+	if d == nil {
+		return
+	}
+	for _, w := range d.workers {
+		w.pending.Add(1)
+		if d.config.Block {
+			w.queue <- it
+			continue
+		}
+		select {
+		case w.queue <- it:
+			w.mutex.Lock()
+			if w.dropping {
+				w.dropping = false
+				d.config.Logf("Sink %s caught up, %d writes dropped so far\n", w.stats.Name, w.stats.Dropped)
+			}
+			w.mutex.Unlock()
+		default:
+			w.pending.Done()
+			w.mutex.Lock()
+			w.stats.Dropped++
+			if !w.dropping {
+				w.dropping = true
+				d.config.Logf("Sink %s is falling behind, dropping writes\n", w.stats.Name)
+			}
+			w.mutex.Unlock()
+		}
+	}
+}
+
+func (d *Dispatcher) run(w *worker) {
+	defer close(w.done)
+	for it := range w.queue {
+		err := write(w.sink, it)
+		kind := it.kind()
+		w.mutex.Lock()
+		if err == nil {
+			w.stats.Written++
+			if w.failing[kind] {
+				w.failing[kind] = false
+				d.config.Logf("Sink %s recovered\n", w.stats.Name)
+			}
+		} else {
+			w.stats.Failed++
+			w.stats.LastError, w.stats.LastErrorTime = err.Error(), time.Now()
+			w.failing[kind] = true
+			d.config.Logf("Sink %s failed: %v\n", w.stats.Name, err)
+		}
+		w.mutex.Unlock()
+		w.pending.Done()
+	}
+	if err := w.sink.Close(); err != nil {
+		d.config.Logf("Closing sink %s failed: %v\n", w.stats.Name, err)
+	}
+}
+
+// Hand an item to the sink, turning a panic into an error so that one broken sink cannot take
+// the collector down.
+func write(sink Sink, it item) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	switch it.kind() {
+	case kindSnapshot:
+		return sink.WriteSnapshot(it.snapshot)
+	case kindEvent:
+		return sink.WriteEvent(it.event)
+	default:
+		return sink.WriteLogEntries(it.logs)
+	}
+}
+
+// Wait until every sink has written everything published so far.
+func (d *Dispatcher) Drain() {
+	if d == nil {
+		return
+	}
+	for _, w := range d.workers {
+		w.pending.Wait()
+	}
+}
+
+// Counters for every sink, in the order they were given.
+func (d *Dispatcher) Stats() []Stats {
+	if d == nil {
+		return nil
+	}
+	var stats []Stats
+	for _, w := range d.workers {
+		w.mutex.Lock()
+		s := w.stats
+		w.mutex.Unlock()
+		s.Queued = len(w.queue)
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Stop accepting writes, give the sinks up to CloseTimeout to work through their queues and
+// close them. Sinks still busy after that are abandoned.
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+	for _, w := range d.workers {
+		close(w.queue)
+	}
+	deadline := time.NewTimer(d.config.CloseTimeout)
+	defer deadline.Stop()
+	expired := false
+	for _, w := range d.workers {
+		if !expired {
+			select {
+			case <-w.done:
+				continue
+			case <-deadline.C:
+				expired = true
+			}
+		}
+		select {
+		case <-w.done:
+		default:
+			d.config.Logf("Sink %s did not finish in %s, abandoning %d queued writes\n",
+				w.stats.Name, d.config.CloseTimeout, len(w.queue))
+		}
+	}
+}
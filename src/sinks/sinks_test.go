@@ -0,0 +1,151 @@
+package sinks_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+)
+
+// Counts the snapshots it is handed.
+type recordingSink struct {
+	sinks.Base
+	mutex     sync.Mutex
+	snapshots int
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) WriteSnapshot(*snapshot.Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshots++
+	return nil
+}
+
+func (s *recordingSink) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.snapshots
+}
+
+// Holds every write until release is closed, and says on started when the first one arrives.
+type slowSink struct {
+	sinks.Base
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *slowSink) Name() string { return "slow" }
+
+func (s *slowSink) WriteSnapshot(*snapshot.Snapshot) error {
+	s.once.Do(func() { close(s.started) })
+	<-s.release
+	return nil
+}
+
+type failingSink struct{ sinks.Base }
+
+func (failingSink) Name() string { return "failing" }
+
+func (failingSink) WriteSnapshot(*snapshot.Snapshot) error { return errors.New("connection refused") }
+
+type panickingSink struct{ sinks.Base }
+
+func (panickingSink) Name() string { return "panicking" }
+
+func (panickingSink) WriteSnapshot(*snapshot.Snapshot) error { panic("nil map") }
+
+func stats(d *sinks.Dispatcher) map[string]sinks.Stats {
+	byName := map[string]sinks.Stats{}
+	for _, s := range d.Stats() {
+		byName[s.Name] = s
+	}
+	return byName
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherIsolatesSinks(t *testing.T) {
+	recording := &recordingSink{}
+	slow := &slowSink{started: make(chan struct{}), release: make(chan struct{})}
+	d := sinks.NewDispatcher(sinks.Config{QueueSize: 2, Logf: func(string, ...interface{}) {}},
+		recording, slow, failingSink{}, panickingSink{})
+	defer d.Close()
+
+	// Publish one snapshot at a time and let the healthy, failing and panicking sinks get through
+	// it, so that only the slow sink falls behind.
+	for i := 1; i <= 5; i++ {
+		d.PublishSnapshot(&snapshot.Snapshot{})
+		waitFor(t, "the other sinks", func() bool {
+			s := stats(d)
+			return recording.count() == i && s["failing"].Failed == int64(i) && s["panicking"].Failed == int64(i)
+		})
+		if i == 1 {
+			<-slow.started
+		}
+	}
+
+	s := stats(d)
+	if got := s["recording"]; got.Written != 5 || got.Failed != 0 || got.Dropped != 0 {
+		t.Errorf("recording sink: %+v, want 5 written", got)
+	}
+	// The first write is in progress, two wait in the queue and the rest did not fit.
+	if got := s["slow"]; got.Written != 0 || got.Queued != 2 || got.Dropped != 2 {
+		t.Errorf("slow sink: %+v, want 2 queued and 2 dropped", got)
+	}
+	if got := s["failing"]; got.Written != 0 || got.Dropped != 0 || got.LastError != "connection refused" {
+		t.Errorf("failing sink: %+v, want 5 failed with the sink's error", got)
+	}
+	if got := s["panicking"]; got.Written != 0 || got.Dropped != 0 || !strings.Contains(got.LastError, "panic: nil map") {
+		t.Errorf("panicking sink: %+v, want 5 failed with the panic", got)
+	}
+
+	close(slow.release)
+	d.Drain()
+	if got := stats(d)["slow"]; got.Written != 3 || got.Queued != 0 || got.Dropped != 2 {
+		t.Errorf("slow sink after catching up: %+v, want 3 written and 2 dropped", got)
+	}
+}
+
+// With Block set a full queue holds up the publisher instead of losing writes.
+func TestDispatcherBlocks(t *testing.T) {
+	slow := &slowSink{started: make(chan struct{}), release: make(chan struct{})}
+	d := sinks.NewDispatcher(sinks.Config{QueueSize: 1, Block: true, Logf: func(string, ...interface{}) {}}, slow)
+	defer d.Close()
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			d.PublishSnapshot(&snapshot.Snapshot{})
+		}
+		close(published)
+	}()
+	<-slow.started
+	select {
+	case <-published:
+		t.Fatal("three writes were published to a sink with room for one while it was busy")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(slow.release)
+	<-published
+	d.Drain()
+	if got := stats(d)["slow"]; got.Written != 3 || got.Dropped != 0 {
+		t.Errorf("slow sink: %+v, want 3 written and none dropped", got)
+	}
+}
@@ -0,0 +1,172 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+)
+
+// Private enterprise number used for the structured data ID. 32473 is reserved for documentation.
+const sdID = "modem@32473"
+
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+)
+
+type Config struct {
+	Address            string
+	Transport          string
+	Facility           int
+	InsecureSkipVerify bool
+	ModemName          string
+}
+
+// Forwards modem log entries as RFC 5424 messages. TCP and TLS use octet-counting framing
+// (RFC 6587) and reconnect on the next write after a failure.
+type Forwarder struct {
+	sinks.Base
+	config Config
+	mutex  sync.Mutex
+	conn   net.Conn
+}
+
+func New(config Config) (*Forwarder, error) {
+	switch config.Transport {
+	case TransportUDP, TransportTCP, TransportTLS:
+	default:
+		return nil, fmt.Errorf("unknown syslog transport %q", config.Transport)
+	}
+	if config.Facility < 0 || config.Facility > 23 {
+		return nil, fmt.Errorf("syslog facility %d out of range", config.Facility)
+	}
+	return &Forwarder{config: config}, nil
+}
+
+func (f *Forwarder) Forward(entries []modem.LogEntry) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, entry := range entries {
+		message := f.format(entry)
+		if f.config.Transport != TransportUDP {
+			message = fmt.Sprintf("%d %s", len(message), message)
+		}
+		if err := f.write(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Forwarder) Name() string { return "syslog" }
+
+func (f *Forwarder) WriteLogEntries(batch *sinks.LogBatch) error {
+	return f.Forward(batch.New)
+}
+
+func (f *Forwarder) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.conn == nil {
+		return nil
+	}
+	err := f.conn.Close()
+	f.conn = nil
+	return err
+}
+
+func (f *Forwarder) write(message string) error {
+	if f.conn == nil {
+		if err := f.dial(); err != nil {
+			return err
+		}
+	}
+	f.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := f.conn.Write([]byte(message)); err != nil {
+		f.conn.Close()
+		f.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (f *Forwarder) dial() error {
+	var err error
+	switch f.config.Transport {
+	case TransportTLS:
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		host, _, _ := net.SplitHostPort(f.config.Address)
+		f.conn, err = tls.DialWithDialer(dialer, "tcp", f.config.Address, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: f.config.InsecureSkipVerify,
+		})
+	default:
+		f.conn, err = net.DialTimeout(f.config.Transport, f.config.Address, 10*time.Second)
+	}
+	return err
+}
+
+// Map a DOCSIS event priority (1 emergency .. 8 debug) to a syslog severity (0 .. 7).
+func Severity(priority int) int {
+	if priority < 1 || priority > 8 {
+		return 6
+	}
+	return priority - 1
+}
+
+func (f *Forwarder) format(entry modem.LogEntry) string {
+	pri := f.config.Facility*8 + Severity(entry.Priority)
+	timestamp := "-"
+	if !entry.Time.IsZero() {
+		timestamp = entry.Time.Format(time.RFC3339)
+	}
+	name := headerField(f.config.ModemName, 48)
+	text, attrs := entry.Attributes()
+
+	params := []string{fmt.Sprintf(`category="%s"`, escapeParam(entry.Event.Category))}
+	if entry.Event.Known() {
+		params = append(params, fmt.Sprintf(`eventId="%s"`, escapeParam(entry.Event.ID)))
+	}
+	for _, p := range []struct{ name, key string }{
+		{"cmMac", "CM-MAC"},
+		{"cmtsMac", "CMTS-MAC"},
+		{"cmQos", "CM-QOS"},
+		{"cmVer", "CM-VER"},
+	} {
+		if value, ok := attrs[p.key]; ok {
+			params = append(params, fmt.Sprintf(`%s="%s"`, p.name, escapeParam(value)))
+		}
+	}
+	sd := "[" + sdID + " " + strings.Join(params, " ") + "]"
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d - %s %s", pri, timestamp, name, name, os.Getpid(), sd, text)
+}
+
+// Header fields are printable US-ASCII without spaces, limited in length, and "-" when empty.
+func headerField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+func escapeParam(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
@@ -0,0 +1,59 @@
+package snapshot
+
+import (
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/health"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+)
+
+// Everything the collector learned from a single poll of the modem.
+type Snapshot struct {
+	Time       time.Time
+	Modem      string
+	Connection *modem.Connection
+	DeviceInfo *modem.DeviceInfo
+	Report     *thresholds.Report
+	Health     *health.Score
+}
+
+// Aggregate values derived from the channel lists. Power spread and error totals only
+// cover SC-QAM downstream channels, matching the "downstream" measurement.
+type Aggregates struct {
+	LockedDownstream int
+	TotalDownstream  int
+	LockedUpstream   int
+	TotalUpstream    int
+	TotalCorrected   int64
+	TotalUncorrected int64
+	PowerSpread      float64
+}
+
+func (s *Snapshot) Aggregates() Aggregates {
+	downstream := s.Connection.DownstreamChannels()
+	upstream := s.Connection.UpstreamChannels()
+	agg := Aggregates{
+		LockedDownstream: s.Connection.Downstream.LockedCount(),
+		TotalDownstream:  len(downstream.SCQAM) + len(downstream.OFDM),
+		LockedUpstream:   s.Connection.Upstream.LockedCount(),
+		TotalUpstream:    len(upstream.SCQAM) + len(upstream.OFDMA),
+	}
+	for _, channel := range downstream.SCQAM {
+		agg.TotalCorrected += channel.Corrected
+		agg.TotalUncorrected += channel.Uncorrected
+	}
+	if len(downstream.SCQAM) > 0 {
+		min, max := downstream.SCQAM[0].Power, downstream.SCQAM[0].Power
+		for _, channel := range downstream.SCQAM[1:] {
+			if channel.Power < min {
+				min = channel.Power
+			}
+			if channel.Power > max {
+				max = channel.Power
+			}
+		}
+		agg.PowerSpread = max - min
+	}
+	return agg
+}
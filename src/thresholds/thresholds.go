@@ -0,0 +1,246 @@
+package thresholds
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+)
+
+type Verdict string
+
+const (
+	Good     Verdict = "good"
+	Marginal Verdict = "marginal"
+	Bad      Verdict = "bad"
+)
+
+// A value inside [Min, Max] is good, within Margin outside of it is marginal and anything further out is bad.
+type Range struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Margin float64 `json:"margin"`
+}
+
+// Fields left out keep the values the range already has, so that a profile file can override
+// just the bound it cares about. A new range without "max" has no upper bound, as is the case
+// for SNR and MER.
+func (r *Range) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Min    *float64 `json:"min"`
+		Max    *float64 `json:"max"`
+		Margin *float64 `json:"margin"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if *r == (Range{}) {
+		r.Max = math.Inf(1)
+	}
+	if raw.Min != nil {
+		r.Min = *raw.Min
+	}
+	if raw.Max != nil {
+		r.Max = *raw.Max
+	}
+	if raw.Margin != nil {
+		r.Margin = *raw.Margin
+	}
+	return nil
+}
+
+type Profile struct {
+	Name                string           `json:"name"`
+	DownstreamPower     Range            `json:"downstream_power"`
+	SNR                 map[string]Range `json:"snr"`
+	OFDMMER             Range            `json:"ofdm_mer"`
+	UpstreamPowerMin    float64          `json:"upstream_power_min"`
+	UpstreamPowerMax    map[int]float64  `json:"upstream_power_max"`
+	UpstreamPowerMargin float64          `json:"upstream_power_margin"`
+}
+
+var Profiles = map[string]Profile{
+	"docsis": {
+		Name:            "docsis",
+		DownstreamPower: Range{Min: -7, Max: 7, Margin: 3},
+		SNR: map[string]Range{
+			"QAM64":   {Min: 27, Max: math.Inf(1), Margin: 3},
+			"QAM256":  {Min: 33, Max: math.Inf(1), Margin: 3},
+			"QAM1024": {Min: 38, Max: math.Inf(1), Margin: 3},
+		},
+		OFDMMER:             Range{Min: 34, Max: math.Inf(1), Margin: 3},
+		UpstreamPowerMin:    38,
+		UpstreamPowerMax:    map[int]float64{1: 61, 2: 58, 3: 55, 4: 54},
+		UpstreamPowerMargin: 3,
+	},
+	"strict": {
+		Name:            "strict",
+		DownstreamPower: Range{Min: -5, Max: 5, Margin: 2},
+		SNR: map[string]Range{
+			"QAM64":   {Min: 30, Max: math.Inf(1), Margin: 2},
+			"QAM256":  {Min: 36, Max: math.Inf(1), Margin: 2},
+			"QAM1024": {Min: 40, Max: math.Inf(1), Margin: 2},
+		},
+		OFDMMER:             Range{Min: 37, Max: math.Inf(1), Margin: 2},
+		UpstreamPowerMin:    40,
+		UpstreamPowerMax:    map[int]float64{1: 58, 2: 55, 3: 52, 4: 51},
+		UpstreamPowerMargin: 2,
+	},
+}
+
+// Look up a built-in profile by name and, when path is set, overlay the JSON profile stored there.
+func Load(name, path string) (*Profile, error) {
+	builtin, ok := Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown thresholds profile %q", name)
+	}
+	profile := builtin
+	profile.SNR = map[string]Range{}
+	for k, v := range builtin.SNR {
+		profile.SNR[k] = v
+	}
+	profile.UpstreamPowerMax = map[int]float64{}
+	for k, v := range builtin.UpstreamPowerMax {
+		profile.UpstreamPowerMax[k] = v
+	}
+	if path == "" {
+		return &profile, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	// Map values are decoded from scratch, so the SNR ranges are overlaid onto the built-in
+	// ones by hand.
+	var overlay struct {
+		SNR map[string]json.RawMessage `json:"snr"`
+	}
+	json.Unmarshal(data, &overlay)
+	for modulation, raw := range overlay.SNR {
+		r := builtin.SNR[modulation]
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		profile.SNR[modulation] = r
+	}
+	return &profile, nil
+}
+
+type ChannelVerdict struct {
+	Channel int
+	Type    modem.ChannelType
+	Verdict Verdict
+	Reasons []string
+}
+
+type Report struct {
+	Downstream map[int]ChannelVerdict
+	Upstream   map[int]ChannelVerdict
+}
+
+func (r *Report) DownstreamVerdict(channel int) Verdict {
+	return r.Downstream[channel].Verdict
+}
+
+func (r *Report) UpstreamVerdict(channel int) Verdict {
+	return r.Upstream[channel].Verdict
+}
+
+func (p *Profile) Evaluate(conn *modem.Connection) *Report {
+	report := &Report{Downstream: map[int]ChannelVerdict{}, Upstream: map[int]ChannelVerdict{}}
+
+	downstream := conn.DownstreamChannels()
+	for _, channel := range downstream.SCQAM {
+		v := newVerdict(channel.Channel, modem.ChannelSCQAM)
+		v.lock(channel.LockStatus)
+		v.check("power", channel.Power, p.DownstreamPower)
+		if snr, ok := p.SNR[strings.ToUpper(channel.Modulation)]; ok {
+			v.check("snr", channel.SNR, snr)
+		}
+		report.Downstream[channel.Channel] = v.ChannelVerdict
+	}
+	for _, channel := range downstream.OFDM {
+		v := newVerdict(channel.Channel, modem.ChannelOFDM)
+		v.lock(channel.LockStatus)
+		v.check("power", channel.Power, p.DownstreamPower)
+		v.check("mer", channel.MER, p.OFDMMER)
+		report.Downstream[channel.Channel] = v.ChannelVerdict
+	}
+
+	upstream := conn.UpstreamChannels()
+	powerLimit := p.upstreamRange(len(upstream.SCQAM) + len(upstream.OFDMA))
+	for _, channel := range upstream.SCQAM {
+		v := newVerdict(channel.Channel, modem.ChannelSCQAM)
+		v.lock(channel.LockStatus)
+		v.check("power", channel.Power, powerLimit)
+		report.Upstream[channel.Channel] = v.ChannelVerdict
+	}
+	for _, channel := range upstream.OFDMA {
+		v := newVerdict(channel.Channel, modem.ChannelOFDMA)
+		v.lock(channel.LockStatus)
+		v.check("power", channel.Power, powerLimit)
+		report.Upstream[channel.Channel] = v.ChannelVerdict
+	}
+	return report
+}
+
+// The allowed upstream transmit power drops as more channels are bonded; counts beyond the
+// largest configured one use that entry's limit. The top Margin dB below the limit is marginal.
+func (p *Profile) upstreamRange(bonded int) Range {
+	limit, largest := 0.0, 0
+	for count, max := range p.UpstreamPowerMax {
+		if count <= bonded && count > largest {
+			limit, largest = max, count
+		}
+	}
+	if largest == 0 {
+		for _, max := range p.UpstreamPowerMax {
+			limit = math.Max(limit, max)
+		}
+	}
+	return Range{Min: p.UpstreamPowerMin, Max: limit - p.UpstreamPowerMargin, Margin: p.UpstreamPowerMargin}
+}
+
+type verdictBuilder struct {
+	ChannelVerdict
+}
+
+func newVerdict(channel int, channelType modem.ChannelType) *verdictBuilder {
+	return &verdictBuilder{ChannelVerdict{Channel: channel, Type: channelType, Verdict: Good}}
+}
+
+func (v *verdictBuilder) lock(status string) {
+	if status != "Locked" {
+		v.downgrade(Bad, fmt.Sprintf("lock status %q", status))
+	}
+}
+
+func (v *verdictBuilder) check(field string, value float64, r Range) {
+	switch {
+	case value >= r.Min && value <= r.Max:
+	case value >= r.Min-r.Margin && value <= r.Max+r.Margin:
+		v.downgrade(Marginal, fmt.Sprintf("%s %.1f outside %s", field, value, r))
+	default:
+		v.downgrade(Bad, fmt.Sprintf("%s %.1f outside %s", field, value, r))
+	}
+}
+
+func (v *verdictBuilder) downgrade(verdict Verdict, reason string) {
+	v.Reasons = append(v.Reasons, reason)
+	if verdict == Bad || v.Verdict == Good {
+		v.Verdict = verdict
+	}
+}
+
+func (r Range) String() string {
+	if math.IsInf(r.Max, 1) {
+		return fmt.Sprintf(">= %.1f", r.Min)
+	}
+	return fmt.Sprintf("%.1f..%.1f", r.Min, r.Max)
+}
@@ -1,54 +1,44 @@
 package utils
 
 import (
-	"bytes"
 	"fmt"
-	"io"
-	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-const chunkSize = 64000
-
 func CalculateSpread(values []float64) float64 {
 	sort.Float64s(values)
 	return values[len(values)-1] - values[0]
 }
 
-func DeepCompare(file1, file2 string) (bool, error) {
-	// Check file size ...
-
-	f1, err := os.Open(file1)
-	if err != nil {
-		return false, err
+// Parse a "since" argument: a duration back from now such as "24h", "30d" or "2w", or a
+// date ("2006-01-02") or RFC 3339 timestamp.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
 	}
-	defer f1.Close()
-
-	f2, err := os.Open(file2)
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	d, err := ParseDuration(s)
 	if err != nil {
-		return false, err
+		return time.Time{}, fmt.Errorf("invalid time %q: expected a duration like 24h or 30d, or a date like 2006-01-02", s)
 	}
-	defer f2.Close()
-
-	for {
-		b1 := make([]byte, chunkSize)
-		_, err1 := f1.Read(b1)
-
-		b2 := make([]byte, chunkSize)
-		_, err2 := f2.Read(b2)
+	return now.Add(-d), nil
+}
 
-		if err1 != nil || err2 != nil {
-			if err1 == io.EOF && err2 == io.EOF {
-				return true, nil
-			} else if err1 == io.EOF || err2 == io.EOF {
-				return false, nil
-			} else {
-				return false, fmt.Errorf("Error1: %v\nError2: %v\n", err1, err2)
+// Like time.ParseDuration, but also accepts whole days ("30d") and weeks ("2w").
+func ParseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil {
+				return 0, err
 			}
-		}
-
-		if !bytes.Equal(b1, b2) {
-			return false, nil
+			return time.Duration(n) * unit, nil
 		}
 	}
+	return time.ParseDuration(s)
 }
@@ -0,0 +1,399 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/breaker"
+	"github.com/RickyGrassmuck/modem_logs/events"
+	"github.com/RickyGrassmuck/modem_logs/history"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/outages"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+	"github.com/RickyGrassmuck/modem_logs/utils"
+)
+
+const apiPrefix = "/api/v1/"
+
+const defaultReadyMaxAge = 2 * time.Minute
+
+// Keeps the token of a browser that opened the dashboard with ?token=.
+const tokenCookie = "modem_stats_token"
+
+type ChannelsResponse struct {
+	Time       time.Time
+	Downstream modem.DownstreamChannels
+	Upstream   modem.UpstreamChannels
+	Report     *thresholds.Report
+}
+
+// A single channel. Channel holds a DownstreamChannel, OFDMChannel, UpstreamChannel or
+// OFDMAChannel depending on Direction and Type.
+type ChannelResponse struct {
+	Time      time.Time
+	Direction string
+	Type      modem.ChannelType
+	Channel   interface{}
+	Verdict   thresholds.ChannelVerdict
+}
+
+type HistoryResponse struct {
+	Query   history.Query
+	Buckets []history.Bucket
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Require the token on every request. Besides the Authorization header, it is taken from the
+// token query parameter, which is then kept in a cookie so that the dashboard's own requests
+// carry it.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.config.Token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(w, r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="modem_stats"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	matches := func(candidate string) bool {
+		return subtle.ConstantTimeCompare([]byte(candidate), []byte(s.config.Token)) == 1
+	}
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return matches(strings.TrimPrefix(header, "Bearer "))
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		if !matches(token) {
+			return false
+		}
+		http.SetCookie(w, &http.Cookie{Name: tokenCookie, Value: s.config.Token, Path: "/",
+			HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteStrictMode})
+		return true
+	}
+	cookie, err := r.Cookie(tokenCookie)
+	return err == nil && matches(cookie.Value)
+}
+
+// The process is up and serving.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// The collector has polled the modem successfully within ReadyMaxAge.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	maxAge := s.config.ReadyMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultReadyMaxAge
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	view := s.Latest()
+	status := breaker.Status{State: breaker.Closed}
+	if s.config.Breaker != nil {
+		status = s.config.Breaker()
+	}
+	switch {
+	case status.State != breaker.Closed:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "modem unreachable for %s: %s\n", time.Since(status.Since).Round(time.Second), status.LastError)
+	case view == nil:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "no successful poll yet")
+	case time.Since(view.Time) > maxAge:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "last successful poll %s ago\n", time.Since(view.Time).Round(time.Second))
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/") == "collect" {
+		s.apiCollect(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "snapshot":
+		s.apiSnapshot(w, r)
+	case len(parts) == 1 && parts[0] == "channels":
+		s.apiChannels(w, r)
+	case len(parts) == 3 && parts[0] == "channels":
+		s.apiChannel(w, r, parts[1], parts[2])
+	case len(parts) == 1 && parts[0] == "logs":
+		s.apiLogs(w, r)
+	case len(parts) == 1 && parts[0] == "events":
+		s.apiEvents(w, r)
+	case len(parts) == 1 && parts[0] == "outages":
+		s.apiOutages(w, r)
+	case len(parts) == 1 && parts[0] == "history":
+		s.apiHistory(w, r)
+	case len(parts) == 1 && parts[0] == "sinks":
+		s.apiSinks(w, r)
+	case len(parts) == 1 && parts[0] == "breaker":
+		s.apiBreaker(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+func (s *Server) latestOrError(w http.ResponseWriter) *View {
+	view := s.Latest()
+	if view == nil {
+		writeError(w, http.StatusServiceUnavailable, "no successful poll yet")
+	}
+	return view
+}
+
+func (s *Server) apiSnapshot(w http.ResponseWriter, r *http.Request) {
+	if view := s.latestOrError(w); view != nil {
+		writeJSON(w, view)
+	}
+}
+
+func (s *Server) apiChannels(w http.ResponseWriter, r *http.Request) {
+	view := s.latestOrError(w)
+	if view == nil {
+		return
+	}
+	writeJSON(w, ChannelsResponse{Time: view.Time, Downstream: view.Downstream, Upstream: view.Upstream, Report: view.Report})
+}
+
+func (s *Server) apiChannel(w http.ResponseWriter, r *http.Request, direction, number string) {
+	view := s.latestOrError(w)
+	if view == nil {
+		return
+	}
+	channel, err := strconv.Atoi(number)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid channel %q", number))
+		return
+	}
+	var report thresholds.Report
+	if view.Report != nil {
+		report = *view.Report
+	}
+	response := ChannelResponse{Time: view.Time, Direction: direction}
+	switch direction {
+	case history.DirectionDownstream:
+		response.Verdict = report.Downstream[channel]
+		for _, c := range view.Downstream.SCQAM {
+			if c.Channel == channel {
+				response.Type, response.Channel = modem.ChannelSCQAM, c
+			}
+		}
+		for _, c := range view.Downstream.OFDM {
+			if c.Channel == channel {
+				response.Type, response.Channel = modem.ChannelOFDM, c
+			}
+		}
+	case history.DirectionUpstream:
+		response.Verdict = report.Upstream[channel]
+		for _, c := range view.Upstream.SCQAM {
+			if c.Channel == channel {
+				response.Type, response.Channel = modem.ChannelSCQAM, c
+			}
+		}
+		for _, c := range view.Upstream.OFDMA {
+			if c.Channel == channel {
+				response.Type, response.Channel = modem.ChannelOFDMA, c
+			}
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown direction %q", direction))
+		return
+	}
+	if response.Channel == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no %s channel %d", direction, channel))
+		return
+	}
+	writeJSON(w, response)
+}
+
+// Log entries, oldest first. Entries without a timestamp are only included without ?since.
+func (s *Server) apiLogs(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseSinceParam(w, r, "")
+	if !ok {
+		return
+	}
+	category := r.URL.Query().Get("category")
+	s.mutex.Lock()
+	all := s.entries
+	s.mutex.Unlock()
+
+	entries := []modem.LogEntry{}
+	for _, entry := range all {
+		if !since.IsZero() && entry.Time.Before(since) {
+			continue
+		}
+		if category != "" && entry.Event.Category != category {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	writeJSON(w, entries)
+}
+
+func (s *Server) apiEvents(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseSinceParam(w, r, "")
+	if !ok {
+		return
+	}
+	eventType := r.URL.Query().Get("type")
+	s.mutex.Lock()
+	all := s.events
+	s.mutex.Unlock()
+
+	filtered := []events.Event{}
+	for _, e := range all {
+		if e.Time.Before(since) || (eventType != "" && e.Type != eventType) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	writeJSON(w, filtered)
+}
+
+// Written, failed and dropped writes of every sink the collector writes to.
+func (s *Server) apiSinks(w http.ResponseWriter, r *http.Request) {
+	stats := []sinks.Stats{}
+	if s.config.SinkStats != nil {
+		stats = append(stats, s.config.SinkStats()...)
+	}
+	writeJSON(w, stats)
+}
+
+// Whether the collector takes the modem to be reachable, and when it tries again if not.
+func (s *Server) apiBreaker(w http.ResponseWriter, r *http.Request) {
+	if s.config.Breaker == nil {
+		writeError(w, http.StatusNotFound, "the collector is not running")
+		return
+	}
+	writeJSON(w, s.config.Breaker())
+}
+
+// GET reports the collection schedule; POST runs a collection now, the one given as ?job= or
+// all of them.
+func (s *Server) apiCollect(w http.ResponseWriter, r *http.Request) {
+	if s.config.Schedule == nil || s.config.Collect == nil {
+		writeError(w, http.StatusNotFound, "the collector is not running")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.config.Schedule())
+	case http.MethodPost:
+		if err := s.config.Collect(r.URL.Query().Get("job")); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "only GET and POST are supported")
+	}
+}
+
+func (s *Server) apiOutages(w http.ResponseWriter, r *http.Request) {
+	if s.config.Journal == nil {
+		writeError(w, http.StatusNotFound, "outage tracking is not enabled")
+		return
+	}
+	since, ok := parseSinceParam(w, r, "7d")
+	if !ok {
+		return
+	}
+	observations, entries, err := s.config.Journal.Read(since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, outages.Analyze(observations, entries, s.config.MaxGap, time.Now().UTC()))
+}
+
+// History of a channel (?series=downstream&channel=3) or an aggregate (?series=snapshot).
+func (s *Server) apiHistory(w http.ResponseWriter, r *http.Request) {
+	if s.config.History == nil {
+		writeError(w, http.StatusNotFound, "history is not enabled")
+		return
+	}
+	since, ok := parseSinceParam(w, r, "24h")
+	if !ok {
+		return
+	}
+	until := time.Now().UTC()
+	if value := r.URL.Query().Get("until"); value != "" {
+		var err error
+		if until, err = utils.ParseSince(value, until); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	step, err := utils.ParseDuration(queryOrDefault(r, "step", "1h"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid step: %v", err))
+		return
+	}
+	query := history.Query{
+		Modem:  s.config.ModemName,
+		Series: queryOrDefault(r, "series", history.SeriesSnapshot),
+		Field:  r.URL.Query().Get("field"),
+		From:   since,
+		To:     until,
+		Step:   step,
+	}
+	if value := r.URL.Query().Get("channel"); value != "" {
+		if query.Channel, err = strconv.Atoi(value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid channel %q", value))
+			return
+		}
+	}
+	buckets, err := s.config.History.Query(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if buckets == nil {
+		buckets = []history.Bucket{}
+	}
+	writeJSON(w, HistoryResponse{Query: query, Buckets: buckets})
+}
+
+// Parse ?since, falling back to defaultVal. An empty result means no lower bound.
+func parseSinceParam(w http.ResponseWriter, r *http.Request, defaultVal string) (time.Time, bool) {
+	value := queryOrDefault(r, "since", defaultVal)
+	if value == "" {
+		return time.Time{}, true
+	}
+	since, err := utils.ParseSince(value, time.Now().UTC())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return time.Time{}, false
+	}
+	return since, true
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: message})
+}
@@ -0,0 +1,428 @@
+package web
+
+import (
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RickyGrassmuck/modem_logs/breaker"
+	"github.com/RickyGrassmuck/modem_logs/events"
+	"github.com/RickyGrassmuck/modem_logs/health"
+	"github.com/RickyGrassmuck/modem_logs/history"
+	modem "github.com/RickyGrassmuck/modem_logs/modem/mb8611"
+	"github.com/RickyGrassmuck/modem_logs/outages"
+	"github.com/RickyGrassmuck/modem_logs/scheduler"
+	"github.com/RickyGrassmuck/modem_logs/sinks"
+	"github.com/RickyGrassmuck/modem_logs/snapshot"
+	"github.com/RickyGrassmuck/modem_logs/thresholds"
+	"github.com/RickyGrassmuck/modem_logs/utils"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// How many of the most recent log entries the dashboard shows.
+const recentLogEntries = 25
+
+// How many collector events are kept for the API.
+const keptEvents = 500
+
+const heartbeatInterval = 30 * time.Second
+
+type Config struct {
+	Address   string
+	ModemName string
+	// When set, every request but the health checks must carry "Authorization: Bearer <Token>".
+	// Browsers open the dashboard once as /?token=<Token>, which keeps the token in a cookie.
+	Token       string
+	TLSCertFile string
+	TLSKeyFile  string
+	// The API reports not ready when the last poll is older than this.
+	ReadyMaxAge time.Duration
+	// Both are optional; without them the charts and the outage list stay empty.
+	History *history.Store
+	Journal *outages.Journal
+	// Gaps between polls longer than this are not counted as monitored time.
+	MaxGap time.Duration
+	// Reports the counters of the collector's sinks; /api/v1/sinks is empty without it.
+	SinkStats func() []sinks.Stats
+	// Report the collection schedule and run a collection job now, or every job for an empty
+	// name. /api/v1/collect is not available without them.
+	Schedule func() []scheduler.Stats
+	Collect  func(job string) error
+	// Reports the state of the collector's circuit breaker for /api/v1/breaker; /readyz reports
+	// not ready while it takes the modem to be unreachable.
+	Breaker func() breaker.Status
+}
+
+// The state of the modem after a poll, as sent to dashboards.
+type View struct {
+	Time         time.Time
+	Modem        string
+	Connectivity string
+	BootStatus   string
+	Uptime       string
+	DeviceInfo   *modem.DeviceInfo
+	Health       *health.Score
+	Aggregates   snapshot.Aggregates
+	Downstream   modem.DownstreamChannels
+	Upstream     modem.UpstreamChannels
+	Report       *thresholds.Report
+	LogEntries   []modem.LogEntry
+}
+
+// Build a view of a snapshot. entries is the modem log, oldest first; the view keeps the most
+// recent entries, newest first.
+func NewView(snap *snapshot.Snapshot, entries []modem.LogEntry) *View {
+	if len(entries) > recentLogEntries {
+		entries = entries[len(entries)-recentLogEntries:]
+	}
+	recent := make([]modem.LogEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		recent = append(recent, entries[i])
+	}
+	return &View{
+		Time:         snap.Time,
+		Modem:        snap.Modem,
+		Connectivity: snap.Connection.ConnectivityStatus,
+		BootStatus:   snap.Connection.BootStatus,
+		Uptime:       snap.Connection.Uptime,
+		DeviceInfo:   snap.DeviceInfo,
+		Health:       snap.Health,
+		Aggregates:   snap.Aggregates(),
+		Downstream:   snap.Connection.DownstreamChannels(),
+		Upstream:     snap.Connection.UpstreamChannels(),
+		Report:       snap.Report,
+		LogEntries:   recent,
+	}
+}
+
+// Serves the dashboard and the API, and pushes a new View to every open page after each poll.
+type Server struct {
+	config      Config
+	httpServer  *http.Server
+	mutex       sync.Mutex
+	latest      *View
+	latestJSON  []byte
+	entries     []modem.LogEntry
+	events      []events.Event
+	subscribers map[chan []byte]bool
+}
+
+func New(config Config) *Server {
+	s := &Server{config: config, subscribers: map[chan []byte]bool{}}
+	s.httpServer = &http.Server{Addr: config.Address, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	data := http.NewServeMux()
+	data.HandleFunc("/", s.handleDashboard)
+	data.HandleFunc("/dashboard/events", s.handleEvents)
+	data.HandleFunc("/dashboard/history", s.handleHistory)
+	data.HandleFunc("/dashboard/outages", s.handleOutages)
+	data.HandleFunc(apiPrefix, s.handleAPI)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.Handle("/", s.authenticate(data))
+	return mux
+}
+
+// Start listening and serve in the background. Errors binding the address or loading the
+// TLS key pair are returned.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return err
+	}
+	if s.config.TLSCertFile == "" {
+		go s.httpServer.Serve(listener)
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.config.TLSCertFile, s.config.TLSKeyFile)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	s.httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	go s.httpServer.ServeTLS(listener, "", "")
+	return nil
+}
+
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	for ch := range s.subscribers {
+		close(ch)
+		delete(s.subscribers, ch)
+	}
+	s.mutex.Unlock()
+	return s.httpServer.Close()
+}
+
+// Latest returns the view published last, or nil before the first poll.
+func (s *Server) Latest() *View {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.latest
+}
+
+// Publish a finished poll and the modem log, oldest entry first, to every connected dashboard.
+// Slow clients miss updates rather than holding up the collector.
+func (s *Server) Publish(snap *snapshot.Snapshot, entries []modem.LogEntry) {
+	view := NewView(snap, entries)
+	data, err := json.Marshal(view)
+	if err != nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latest, s.latestJSON, s.entries = view, data, entries
+	for ch := range s.subscribers {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+func (s *Server) Name() string { return "web" }
+
+// Publish the snapshot with the log from the most recent WriteLogEntries.
+func (s *Server) WriteSnapshot(snap *snapshot.Snapshot) error {
+	s.mutex.Lock()
+	entries := s.entries
+	s.mutex.Unlock()
+	s.Publish(snap, entries)
+	return nil
+}
+
+func (s *Server) WriteLogEntries(batch *sinks.LogBatch) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries = batch.All
+	return nil
+}
+
+func (s *Server) WriteEvent(e *events.Event) error {
+	s.RecordEvent(e)
+	return nil
+}
+
+// Keep a collector event for the API, dropping the oldest beyond keptEvents.
+func (s *Server) RecordEvent(e *events.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, *e)
+	if len(s.events) > keptEvents {
+		s.events = s.events[len(s.events)-keptEvents:]
+	}
+}
+
+func (s *Server) subscribe() (chan []byte, []byte) {
+	ch := make(chan []byte, 1)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.subscribers[ch] = true
+	return ch, s.latestJSON
+}
+
+func (s *Server) unsubscribe(ch chan []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.subscribers[ch] {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch, latest := s.subscribe()
+	defer s.unsubscribe(ch)
+	if latest != nil {
+		fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", latest)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+type historyResponse struct {
+	Enabled bool                        `json:"enabled"`
+	Series  map[string][]history.Bucket `json:"series"`
+}
+
+// Chart data: the given field of every channel in the latest poll, or an aggregate field
+// when no direction is given.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	response := historyResponse{Series: map[string][]history.Bucket{}}
+	if s.config.History == nil {
+		writeJSON(w, response)
+		return
+	}
+	response.Enabled = true
+
+	now := time.Now().UTC()
+	since, err := utils.ParseSince(queryOrDefault(r, "since", "24h"), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, err := utils.ParseDuration(queryOrDefault(r, "step", "15m"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := history.Query{Modem: s.config.ModemName, Field: r.URL.Query().Get("field"), From: since, To: now, Step: step}
+
+	var channels []int
+	switch direction := r.URL.Query().Get("direction"); direction {
+	case "":
+		query.Series = history.SeriesSnapshot
+		channels = []int{0}
+	case history.DirectionDownstream, history.DirectionUpstream:
+		query.Series = direction
+		channels = s.latestChannels(direction)
+	default:
+		http.Error(w, fmt.Sprintf("unknown direction %q", direction), http.StatusBadRequest)
+		return
+	}
+	for _, channel := range channels {
+		query.Channel = channel
+		buckets, err := s.config.History.Query(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := query.Field
+		if query.Series != history.SeriesSnapshot {
+			name = strconv.Itoa(channel)
+		}
+		response.Series[name] = buckets
+	}
+	writeJSON(w, response)
+}
+
+func (s *Server) latestChannels(direction string) []int {
+	view := s.Latest()
+	if view == nil {
+		return nil
+	}
+	var channels []int
+	if direction == history.DirectionDownstream {
+		for _, c := range view.Downstream.SCQAM {
+			channels = append(channels, c.Channel)
+		}
+		for _, c := range view.Downstream.OFDM {
+			channels = append(channels, c.Channel)
+		}
+	} else {
+		for _, c := range view.Upstream.SCQAM {
+			channels = append(channels, c.Channel)
+		}
+		for _, c := range view.Upstream.OFDMA {
+			channels = append(channels, c.Channel)
+		}
+	}
+	return channels
+}
+
+type outageView struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Ongoing  bool      `json:"ongoing"`
+	Duration string    `json:"duration"`
+	Cause    string    `json:"cause"`
+}
+
+type outagesResponse struct {
+	Enabled      bool         `json:"enabled"`
+	Outages      []outageView `json:"outages"`
+	Downtime     string       `json:"downtime"`
+	Monitored    string       `json:"monitored"`
+	Availability float64      `json:"availability"`
+}
+
+func (s *Server) handleOutages(w http.ResponseWriter, r *http.Request) {
+	var response outagesResponse
+	if s.config.Journal == nil {
+		writeJSON(w, response)
+		return
+	}
+	response.Enabled = true
+	now := time.Now().UTC()
+	since, err := utils.ParseSince(queryOrDefault(r, "since", "7d"), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	observations, entries, err := s.config.Journal.Read(since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	summary := outages.Analyze(observations, entries, s.config.MaxGap, now)
+	// Most recent first.
+	for i := len(summary.Outages) - 1; i >= 0; i-- {
+		o := summary.Outages[i]
+		response.Outages = append(response.Outages, outageView{
+			Start: o.Start, End: o.End, Ongoing: o.Ongoing, Duration: o.Duration().Round(time.Second).String(), Cause: o.Cause,
+		})
+	}
+	response.Downtime = summary.Downtime.Round(time.Second).String()
+	response.Monitored = summary.Monitored.Round(time.Minute).String()
+	response.Availability = summary.Availability
+	writeJSON(w, response)
+}
+
+func queryOrDefault(r *http.Request, name string, defaultVal string) string {
+	if value := r.URL.Query().Get(name); value != "" {
+		return value
+	}
+	return defaultVal
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}